@@ -3,18 +3,33 @@ package conf
 import (
 	"encoding/json"
 	"flag"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/winterssy/easylog"
+	"github.com/winterssy/music-get/pkg/ratelimit"
 	"github.com/winterssy/music-get/utils"
 )
 
 const (
 	MaxConcurrentDownloadTasksCount = 16
-	DefaultDownloadBr               = 128
+	DefaultID3v2Version             = 3
+	DefaultRetryAttempts            = 3
+	DefaultRetryWait                = time.Second
+	DefaultTimeout                  = 30 * time.Second
+)
+
+// Audio qualities, a provider would step down to the lower one if the requested is unavailable.
+const (
+	QualityStandard = iota
+	QualityHigh
+	QualityLossless
 )
 
 var (
@@ -22,34 +37,117 @@ var (
 	Conf                         = &Config{}
 	downloadOverwrite            bool
 	concurrentDownloadTasksCount int
+	inputFile                    string
+	embedTag                     bool
+	downloadLyrics               bool
+	saveCover                    bool
+	coverMaxSize                 int
+	id3v2Version                 int
+	retryAttempts                int
+	retryWait                    time.Duration
+	timeout                      time.Duration
+	proxy                        string
+	quality                      string
+	fallback                     string
+	dryRun                       bool
+	jsonOutput                   bool
+	reportFile                   string
+	limitRate                    string
+	verifyAudio                  bool
+	outputTemplate               string
+	sanitizeProfile              string
+	fullWidth                    bool
+	playlist                     string
+	useHistory                   bool
 	Debug                        bool
+
+	qualityNames = map[string]int{
+		"standard": QualityStandard,
+		"high":     QualityHigh,
+		"lossless": QualityLossless,
+	}
+
+	playlistFormats = map[string]bool{
+		"m3u8": true,
+		"xspf": true,
+	}
+
+	// persisted are the options loaded from the config file, the command line overrides them without saving
+	persisted Config
 )
 
 type (
 	Config struct {
-		Cookies                      []*http.Cookie `json:"cookies,omitempty"`
-		Workspace                    string         `json:"-"`
-		DownloadDir                  string         `json:"-"`
-		DownloadOverwrite            bool           `json:"-"`
-		ConcurrentDownloadTasksCount int            `json:"-"`
+		Cookies                      []*http.Cookie     `json:"cookies,omitempty"`
+		Proxies                      map[string]string  `json:"proxies,omitempty"`
+		RateLimits                   map[string]float64 `json:"rateLimits,omitempty"`
+		Workspace                    string             `json:"-"`
+		DownloadDir                  string             `json:"-"`
+		DownloadOverwrite            bool               `json:"-"`
+		ConcurrentDownloadTasksCount int                `json:"-"`
+		InputFile                    string             `json:"-"`
+		EmbedTag                     bool               `json:"-"`
+		DownloadLyrics               bool               `json:"-"`
+		SaveCover                    bool               `json:"-"`
+		CoverMaxSize                 int                `json:"-"`
+		ID3v2Version                 int                `json:"-"`
+		RetryAttempts                int                `json:"retryAttempts,omitempty"`
+		RetryWait                    Duration           `json:"retryWait,omitempty"`
+		Timeout                      time.Duration      `json:"-"`
+		Proxy                        string             `json:"-"`
+		Quality                      Quality            `json:"quality,omitempty"`
+		Fallback                     []string           `json:"-"`
+		DryRun                       bool               `json:"-"`
+		JSONOutput                   bool               `json:"-"`
+		ReportFile                   string             `json:"-"`
+		LimitRate                    int64              `json:"-"`
+		VerifyAudio                  bool               `json:"-"`
+		OutputTemplate               string             `json:"-"`
+		SanitizeProfile              string             `json:"-"`
+		FullWidth                    bool               `json:"-"`
+		PlaylistFormats              []string           `json:"-"`
+		History                      bool               `json:"-"`
 	}
+
+	// Duration is a time.Duration which is saved as a string such as "1.5s" in the config file.
+	Duration time.Duration
+
+	// Quality is an audio quality which is saved by its name such as "lossless" in the config file.
+	Quality int
 )
 
 func init() {
 	flag.BoolVar(&Debug, "v", false, "debug mode")
 	flag.BoolVar(&downloadOverwrite, "f", false, "overwrite already downloaded music")
 	flag.IntVar(&concurrentDownloadTasksCount, "n", 1, "concurrent download tasks count, max 16")
+	flag.BoolVar(&embedTag, "tag", true, "embed metadata tags into downloaded music")
+	flag.BoolVar(&downloadLyrics, "lyrics", false, "download lyrics (.lrc) alongside music")
+	flag.BoolVar(&saveCover, "cover", false, "save album cover as cover.jpg into album directory")
+	flag.IntVar(&coverMaxSize, "cover-size", 0, "max width/height of cover in pixels, 0 means original size")
+	flag.IntVar(&id3v2Version, "id3v2", DefaultID3v2Version, "ID3v2 tag version, 3 or 4")
+	flag.IntVar(&retryAttempts, "retry", DefaultRetryAttempts, "max attempts of a request or transfer, 1 means no retry")
+	flag.DurationVar(&retryWait, "retry-wait", DefaultRetryWait, "initial wait between retries, doubled every attempt")
+	flag.DurationVar(&timeout, "timeout", DefaultTimeout, "timeout of connecting and waiting for response headers")
+	flag.StringVar(&proxy, "proxy", "", "proxy URL, such as http://127.0.0.1:1080, use environment variables by default")
+	flag.StringVar(&quality, "q", "standard", "audio quality, standard, high or lossless")
+	flag.StringVar(&fallback, "fallback", "", "search unavailable songs on the specified platforms, comma separated, such as qq,kuwo,migu")
+	flag.BoolVar(&dryRun, "dry-run", false, "print the resolved songs without downloading")
+	flag.BoolVar(&jsonOutput, "json", false, "print the dry run result as JSON")
+	flag.StringVar(&reportFile, "report", "", "write a per-track report, CSV if the file name ends with .csv, otherwise JSON")
+	flag.BoolVar(&verifyAudio, "verify", true, "verify downloaded files are complete audio of the expected duration")
+	flag.StringVar(&limitRate, "limit-rate", "", "max download speed shared by all tasks, such as 500K or 2M")
+	flag.StringVar(&outputTemplate, "o", "", "template of the save path, such as \"{albumartist}/{album}/{track:02} {title}.{ext}\"")
+	flag.StringVar(&playlist, "playlist", "m3u8", "playlist files written for albums and playlists, comma separated, m3u8 or xspf, \"none\" to disable")
+	flag.BoolVar(&useHistory, "history", true, "skip the songs in the download history even if moved or renamed, and record the downloads")
+	flag.StringVar(&sanitizeProfile, "sanitize", utils.DefaultProfile(), "file name rules, posix, macos, windows or portable (valid on all)")
+	flag.BoolVar(&fullWidth, "fullwidth", false, "replace invalid file name characters with full-width ones instead of deleting them")
+	flag.StringVar(&inputFile, "i", "", "read music addresses from file, one per line, \"-\" for stdin")
 }
 
 func Init() error {
 	if Debug {
 		easylog.SetLevel(easylog.Ldebug)
 	}
-	if concurrentDownloadTasksCount < 1 || concurrentDownloadTasksCount > MaxConcurrentDownloadTasksCount {
-		easylog.Warn("Invalid n parameter, use default value")
-		concurrentDownloadTasksCount = 1
-	}
-
 	pwd, err := os.Getwd()
 	if err != nil {
 		return err
@@ -59,6 +157,75 @@ func Init() error {
 	if err = load(confPath); err != nil {
 		easylog.Warn("Load config file failed, you may run for the first time")
 	}
+	persisted = *Conf
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	if !set["retry"] && Conf.RetryAttempts != 0 {
+		retryAttempts = Conf.RetryAttempts
+	}
+	if !set["retry-wait"] && Conf.RetryWait != 0 {
+		retryWait = time.Duration(Conf.RetryWait)
+	}
+	if !set["q"] && Conf.Quality != QualityStandard {
+		quality = Conf.Quality.String()
+	}
+
+	if concurrentDownloadTasksCount < 1 || concurrentDownloadTasksCount > MaxConcurrentDownloadTasksCount {
+		easylog.Warn("Invalid n parameter, use default value")
+		concurrentDownloadTasksCount = 1
+	}
+	if coverMaxSize < 0 {
+		easylog.Warn("Invalid cover-size parameter, use default value")
+		coverMaxSize = 0
+	}
+	if id3v2Version != 3 && id3v2Version != 4 {
+		easylog.Warn("Invalid id3v2 parameter, use default value")
+		id3v2Version = DefaultID3v2Version
+	}
+	if retryAttempts < 1 {
+		easylog.Warn("Invalid retry parameter, use default value")
+		retryAttempts = DefaultRetryAttempts
+	}
+	if retryWait < 0 {
+		easylog.Warn("Invalid retry-wait parameter, use default value")
+		retryWait = DefaultRetryWait
+	}
+	if timeout < 0 {
+		easylog.Warn("Invalid timeout parameter, use default value")
+		timeout = DefaultTimeout
+	}
+	q, ok := qualityNames[quality]
+	if !ok {
+		easylog.Warn("Invalid q parameter, use default value")
+		q = QualityStandard
+	}
+	var rate int64
+	if limitRate != "" {
+		var err error
+		if rate, err = ratelimit.ParseRate(limitRate); err != nil {
+			easylog.Warn("Invalid limit-rate parameter, use default value")
+		}
+	}
+	var formats []string
+	for _, i := range strings.Split(playlist, ",") {
+		if i = strings.ToLower(strings.TrimSpace(i)); i == "" || i == "none" {
+			continue
+		}
+		if !playlistFormats[i] {
+			easylog.Warn("Invalid playlist parameter, use default value")
+			formats = []string{"m3u8"}
+			break
+		}
+		formats = append(formats, i)
+	}
+	sanitizer, err := utils.NewSanitizer(sanitizeProfile, fullWidth)
+	if err != nil {
+		easylog.Warn("Invalid sanitize parameter, use default value")
+		sanitizer, _ = utils.NewSanitizer("", fullWidth)
+	}
+	utils.SetSanitizer(sanitizer)
 
 	downloadDir := filepath.Join(pwd, "downloads")
 	if err = utils.BuildPathIfNotExist(downloadDir); err != nil {
@@ -69,6 +236,32 @@ func Init() error {
 	Conf.DownloadDir = downloadDir
 	Conf.DownloadOverwrite = downloadOverwrite
 	Conf.ConcurrentDownloadTasksCount = concurrentDownloadTasksCount
+	Conf.InputFile = inputFile
+	Conf.EmbedTag = embedTag
+	Conf.DownloadLyrics = downloadLyrics
+	Conf.SaveCover = saveCover
+	Conf.CoverMaxSize = coverMaxSize
+	Conf.ID3v2Version = id3v2Version
+	Conf.RetryAttempts = retryAttempts
+	Conf.RetryWait = Duration(retryWait)
+	Conf.Timeout = timeout
+	Conf.Proxy = proxy
+	Conf.Quality = Quality(q)
+	Conf.DryRun = dryRun
+	Conf.JSONOutput = jsonOutput
+	Conf.ReportFile = reportFile
+	Conf.LimitRate = rate
+	Conf.VerifyAudio = verifyAudio
+	Conf.OutputTemplate = strings.TrimSpace(outputTemplate)
+	Conf.SanitizeProfile = sanitizer.Profile
+	Conf.FullWidth = fullWidth
+	Conf.PlaylistFormats = formats
+	Conf.History = useHistory
+	for _, i := range strings.Split(fallback, ",") {
+		if i = strings.TrimSpace(i); i != "" {
+			Conf.Fallback = append(Conf.Fallback, i)
+		}
+	}
 	return nil
 }
 
@@ -81,10 +274,48 @@ func load(confPath string) error {
 }
 
 func (c *Config) Save() error {
-	data, err := json.MarshalIndent(c, "", "\t")
+	saved := *c
+	saved.RetryAttempts, saved.RetryWait = persisted.RetryAttempts, persisted.RetryWait
+	saved.Quality = persisted.Quality
+	data, err := json.MarshalIndent(&saved, "", "\t")
 	if err != nil {
 		return err
 	}
 
 	return ioutil.WriteFile(confPath, data, 0644)
 }
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (q Quality) String() string {
+	for k, v := range qualityNames {
+		if v == int(q) {
+			return k
+		}
+	}
+	return strconv.Itoa(int(q))
+}
+
+func (q Quality) MarshalText() ([]byte, error) {
+	return []byte(q.String()), nil
+}
+
+func (q *Quality) UnmarshalText(text []byte) error {
+	v, ok := qualityNames[string(text)]
+	if !ok {
+		return fmt.Errorf("invalid quality: %s", text)
+	}
+	*q = Quality(v)
+	return nil
+}
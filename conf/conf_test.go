@@ -0,0 +1,58 @@
+package conf
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfig_Save(t *testing.T) {
+	dir, err := ioutil.TempDir("", "music-get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	confPath = filepath.Join(dir, "music-get.json")
+	if err = ioutil.WriteFile(confPath, []byte(`{"retryAttempts":5,"retryWait":"1.5s","quality":"lossless"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	Conf = &Config{}
+	if err = load(confPath); err != nil {
+		t.Fatal(err)
+	}
+	if Conf.RetryAttempts != 5 || time.Duration(Conf.RetryWait) != 1500*time.Millisecond || Conf.Quality != QualityLossless {
+		t.Fatalf("load got %d, %s, %s", Conf.RetryAttempts, time.Duration(Conf.RetryWait), Conf.Quality)
+	}
+
+	// the options overridden by the command line are not saved
+	persisted = *Conf
+	Conf.RetryAttempts, Conf.RetryWait, Conf.Quality = 1, Duration(time.Minute), QualityHigh
+	if err = Conf.Save(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(confPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved map[string]interface{}
+	if err = json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved["retryAttempts"] != 5.0 || saved["retryWait"] != "1.5s" || saved["quality"] != "lossless" {
+		t.Errorf("Save got %s", data)
+	}
+}
+
+func TestQuality_UnmarshalText(t *testing.T) {
+	var q Quality
+	if err := q.UnmarshalText([]byte("high")); err != nil || q != QualityHigh {
+		t.Errorf("UnmarshalText got %s, %v", q, err)
+	}
+	if err := q.UnmarshalText([]byte("320k")); err == nil {
+		t.Error("UnmarshalText should fail on unknown quality")
+	}
+}
@@ -0,0 +1,159 @@
+// Package download runs the download tasks with a pool of workers,
+// and reports the events of each task to the observers.
+package download
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/winterssy/music-get/internal/ecode"
+	"github.com/winterssy/music-get/provider"
+)
+
+const (
+	Queued EventType = iota
+	Started
+	Progress
+	Done
+	Failed
+)
+
+var (
+	eventTypeNames = map[EventType]string{
+		Queued:   "queued",
+		Started:  "started",
+		Progress: "progress",
+		Done:     "done",
+		Failed:   "failed",
+	}
+)
+
+type (
+	EventType int
+
+	// Event is what happens to a task.
+	Event struct {
+		Type EventType
+		// Index is the position of the task in the list
+		Index int
+		MP3   *provider.MP3
+		// Current and Total are the bytes of a Progress event, Total is -1 if unknown
+		Current int64
+		Total   int64
+		// Task is the result of a Done or Failed event
+		Task *provider.DownloadTask
+	}
+
+	// Observer receives the events of an engine. The events are delivered one by one,
+	// so an observer needn't be safe for concurrent use, but it should return quickly.
+	Observer interface {
+		Notify(e *Event)
+	}
+
+	// ObserverFunc adapts a function to an Observer.
+	ObserverFunc func(e *Event)
+
+	// Engine downloads the songs with a fixed number of workers.
+	Engine struct {
+		workers   int
+		observers []Observer
+		mu        sync.Mutex
+	}
+
+	progressReader struct {
+		r       io.Reader
+		current int64
+		total   int64
+		notify  func(current, total int64)
+	}
+)
+
+func (t EventType) String() string {
+	return eventTypeNames[t]
+}
+
+func (f ObserverFunc) Notify(e *Event) {
+	f(e)
+}
+
+// New creates an engine with the number of workers, at least 1.
+func New(workers int, observers ...Observer) *Engine {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Engine{
+		workers:   workers,
+		observers: observers,
+	}
+}
+
+// Observe adds an observer, it should be called before Run.
+func (e *Engine) Observe(o Observer) {
+	e.observers = append(e.observers, o)
+}
+
+// Run downloads the songs and returns the results in the same order. A task succeeds
+// if its status is ecode.Success, ecode.AlreadyDownloaded or ecode.DownloadedBefore, otherwise it fails.
+// Once ctx is done, the remaining tasks are canceled without starting.
+func (e *Engine) Run(ctx context.Context, mp3List []*provider.MP3) []provider.DownloadTask {
+	for i, m := range mp3List {
+		e.notify(&Event{Type: Queued, Index: i, MP3: m})
+	}
+
+	tasks := make([]provider.DownloadTask, len(mp3List))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for n := 0; n < e.workers && n < len(mp3List); n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				tasks[i] = e.download(ctx, i, mp3List[i])
+			}
+		}()
+	}
+	for i := range mp3List {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return tasks
+}
+
+func (e *Engine) download(ctx context.Context, i int, m *provider.MP3) provider.DownloadTask {
+	e.notify(&Event{Type: Started, Index: i, MP3: m})
+	task := m.Download(ctx, func(r io.Reader, current, total int64) io.Reader {
+		e.notify(&Event{Type: Progress, Index: i, MP3: m, Current: current, Total: total})
+		return &progressReader{r: r, current: current, total: total, notify: func(current, total int64) {
+			e.notify(&Event{Type: Progress, Index: i, MP3: m, Current: current, Total: total})
+		}}
+	})
+
+	event := &Event{Type: Done, Index: i, MP3: m, Task: &task}
+	switch task.Status {
+	case ecode.Success, ecode.AlreadyDownloaded, ecode.DownloadedBefore:
+	default:
+		event.Type = Failed
+	}
+	e.notify(event)
+	return task
+}
+
+func (e *Engine) notify(event *Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, o := range e.observers {
+		o.Notify(event)
+	}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.current += int64(n)
+		p.notify(p.current, p.total)
+	}
+	return n, err
+}
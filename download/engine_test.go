@@ -0,0 +1,218 @@
+package download
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/winterssy/music-get/conf"
+	"github.com/winterssy/music-get/internal/ecode"
+	"github.com/winterssy/music-get/pkg/history"
+	"github.com/winterssy/music-get/provider"
+	"github.com/winterssy/music-get/utils"
+)
+
+const body = "music-get"
+
+func testServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+}
+
+func testDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "music-get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf.Conf.DownloadDir = dir
+	return dir
+}
+
+func testSong(srv *httptest.Server, id, name string) *provider.MP3 {
+	return &provider.MP3{
+		FileName:    name,
+		SavePath:    ".",
+		Playable:    true,
+		DownloadURL: srv.URL + "/" + name,
+		Provider:    provider.NetEaseMusic,
+		Track:       &provider.Track{Id: id, BitRate: 320},
+	}
+}
+
+func TestEngine_Run(t *testing.T) {
+	srv := testServer()
+	defer srv.Close()
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+
+	mp3List := []*provider.MP3{
+		{FileName: "a.mp3", SavePath: ".", Playable: true, DownloadURL: srv.URL + "/a.mp3"},
+		{FileName: "b.mp3", SavePath: "."},
+		{FileName: "c.mp3", SavePath: "sub", Playable: true, DownloadURL: srv.URL + "/c.mp3"},
+	}
+
+	events := make(map[int][]EventType)
+	var progress int64
+	engine := New(2, ObserverFunc(func(e *Event) {
+		events[e.Index] = append(events[e.Index], e.Type)
+		if e.Type == Progress && e.Index == 0 {
+			progress = e.Current
+		}
+	}))
+	tasks := engine.Run(context.Background(), mp3List)
+
+	want := []int{ecode.Success, ecode.SongUnavailable, ecode.Success}
+	for i, task := range tasks {
+		if task.MP3 != mp3List[i] || task.Status != want[i] {
+			t.Errorf("Run got task %d: %s, want: %s", i, ecode.Message(task.Status), ecode.Message(want[i]))
+		}
+	}
+	if tasks[2].Path != filepath.Join(dir, "sub", "c.mp3") || tasks[2].Bytes != int64(len(body)) {
+		t.Errorf("Run got task 2: %s (%d bytes)", tasks[2].Path, tasks[2].Bytes)
+	}
+	if progress != int64(len(body)) {
+		t.Errorf("Run got progress: %d, want: %d", progress, len(body))
+	}
+
+	for i, want := range []string{"queued started progress done", "queued started failed"} {
+		got := make([]string, 0, len(events[i]))
+		for _, e := range events[i] {
+			if e == Progress && len(got) > 0 && got[len(got)-1] == "progress" {
+				continue
+			}
+			got = append(got, e.String())
+		}
+		if strings.Join(got, " ") != want {
+			t.Errorf("Run got events of task %d: %v, want: %s", i, got, want)
+		}
+	}
+}
+
+func TestEngine_RunCanceled(t *testing.T) {
+	srv := testServer()
+	defer srv.Close()
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	mp3List := []*provider.MP3{
+		{FileName: "a.mp3", SavePath: ".", Playable: true, DownloadURL: srv.URL + "/a.mp3"},
+	}
+	tasks := New(1).Run(ctx, mp3List)
+	if tasks[0].Status != ecode.DownloadCanceled {
+		t.Errorf("Run got: %s, want: %s", ecode.Message(tasks[0].Status), ecode.Message(ecode.DownloadCanceled))
+	}
+	if _, err := os.Stat(tasks[0].Path); !os.IsNotExist(err) {
+		t.Errorf("Run canceled task should not create file: %v", err)
+	}
+}
+
+func TestEngine_RunAborted(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte(body))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mp3List := []*provider.MP3{
+		{FileName: "a.mp3", SavePath: ".", Playable: true, DownloadURL: srv.URL + "/a.mp3"},
+	}
+	engine := New(1, ObserverFunc(func(e *Event) {
+		if e.Type == Progress && e.Current > 0 {
+			cancel()
+		}
+	}))
+	tasks := engine.Run(ctx, mp3List)
+	if tasks[0].Status != ecode.DownloadCanceled {
+		t.Errorf("Run got: %s, want: %s", ecode.Message(tasks[0].Status), ecode.Message(ecode.DownloadCanceled))
+	}
+	if _, err := os.Stat(tasks[0].Path + provider.PartFileExt); !os.IsNotExist(err) {
+		t.Errorf("Run aborted task should remove the partial file: %v", err)
+	}
+}
+
+func TestEngine_RunVerify(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><body>403 Forbidden</body></html>"))
+	}))
+	defer srv.Close()
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+	conf.Conf.VerifyAudio = true
+	defer func() {
+		conf.Conf.VerifyAudio = false
+	}()
+
+	mp3List := []*provider.MP3{
+		{FileName: "a.mp3", SavePath: ".", Playable: true, DownloadURL: srv.URL + "/a.mp3"},
+	}
+	tasks := New(1).Run(context.Background(), mp3List)
+	if tasks[0].Status != ecode.AudioVerifyException {
+		t.Errorf("Run got: %s, want: %s", ecode.Message(tasks[0].Status), ecode.Message(ecode.AudioVerifyException))
+	}
+	if _, err := os.Stat(tasks[0].Path); !os.IsNotExist(err) {
+		t.Errorf("Run should remove the invalid file: %v", err)
+	}
+}
+
+func TestEngine_RunHistory(t *testing.T) {
+	srv := testServer()
+	defer srv.Close()
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+
+	store, err := history.Open(filepath.Join(dir, "history.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider.UseHistory(store)
+	defer provider.UseHistory(nil)
+
+	// a is downloaded, then saved with another name, so the recorded file is reused
+	tasks := New(1).Run(context.Background(), []*provider.MP3{testSong(srv, "1", "a.mp3")})
+	if tasks[0].Status != ecode.Success {
+		t.Fatalf("Run got task: %s", ecode.Message(tasks[0].Status))
+	}
+	recorded := tasks[0].Path
+	r, ok := store.Get("netease", "1")
+	if !ok || r.Path != recorded || r.Size != int64(len(body)) || r.Quality != "mp3 320k" || r.Hash == "" {
+		t.Fatalf("Run recorded history: %+v", r)
+	}
+
+	tasks = New(1).Run(context.Background(), []*provider.MP3{testSong(srv, "1", "b.mp3")})
+	if tasks[0].Status != ecode.AlreadyDownloaded || tasks[0].Path != recorded {
+		t.Errorf("Run got task: %s %s", ecode.Message(tasks[0].Status), tasks[0].Path)
+	}
+	if exists, _ := utils.ExistsPath(filepath.Join(dir, "b.mp3")); exists {
+		t.Error("Run should not download the song in the history again")
+	}
+
+	// the recorded file is moved out of band, the stale path is not returned
+	if err = os.Rename(recorded, filepath.Join(dir, "moved.mp3")); err != nil {
+		t.Fatal(err)
+	}
+	var event EventType
+	engine := New(1, ObserverFunc(func(e *Event) {
+		event = e.Type
+	}))
+	tasks = engine.Run(context.Background(), []*provider.MP3{testSong(srv, "1", "b.mp3")})
+	if tasks[0].Status != ecode.DownloadedBefore || tasks[0].Path != filepath.Join(dir, "b.mp3") || event != Done {
+		t.Errorf("Run got task: %s %s, event %v", ecode.Message(tasks[0].Status), tasks[0].Path, event)
+	}
+	if exists, _ := utils.ExistsPath(filepath.Join(dir, "b.mp3")); exists {
+		t.Error("Run should not download the song in the history again")
+	}
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/winterssy/music-get/provider"
+)
+
+const (
+	StdinFileName = "-"
+)
+
+// ReadAddressFile reads music addresses from a batch input file, one per line.
+// Blank lines and lines starting with "#" are ignored, "-" means read from stdin.
+func ReadAddressFile(name string) ([]string, error) {
+	if name == StdinFileName {
+		return readAddresses(os.Stdin)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return readAddresses(f)
+}
+
+func readAddresses(r io.Reader) ([]string, error) {
+	urls := make([]string, 0)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	return urls, scanner.Err()
+}
+
+// MergeMP3List merges multiple mp3 lists into one download queue,
+// the same songs or songs saving to the same path would be downloaded only once.
+func MergeMP3List(lists ...[]*provider.MP3) []*provider.MP3 {
+	n := 0
+	for _, i := range lists {
+		n += len(i)
+	}
+
+	seen := make(map[string]bool, n)
+	mp3List := make([]*provider.MP3, 0, n)
+	for _, list := range lists {
+		for _, m := range list {
+			path, key := filepath.Join(m.SavePath, m.FileName), m.Key()
+			if seen[path] || (key != "" && seen[key]) {
+				continue
+			}
+			seen[path] = true
+			if key != "" {
+				seen[key] = true
+			}
+			mp3List = append(mp3List, m)
+		}
+	}
+
+	return mp3List
+}
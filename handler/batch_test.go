@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/winterssy/music-get/provider"
+)
+
+func TestReadAddresses(t *testing.T) {
+	input := `
+# netease
+https://music.163.com/#/song?id=553310243
+
+  https://y.qq.com/n/yqq/song/002Zkt5S2z8JZx.html  
+#http://www.kuwo.cn/play_detail/76323299
+`
+	want := []string{
+		"https://music.163.com/#/song?id=553310243",
+		"https://y.qq.com/n/yqq/song/002Zkt5S2z8JZx.html",
+	}
+
+	got, err := readAddresses(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readAddresses got: %v, want: %v", got, want)
+	}
+}
+
+func TestMergeMP3List(t *testing.T) {
+	a := &provider.MP3{FileName: "a.mp3", SavePath: "album"}
+	b := &provider.MP3{FileName: "b.mp3", SavePath: "album"}
+	c := &provider.MP3{FileName: "a.mp3", SavePath: "playlist", Track: &provider.Track{Id: "1"}}
+	d := &provider.MP3{FileName: "d.mp3", SavePath: "playlist", Track: &provider.Track{Id: "1"}}
+
+	got := MergeMP3List(
+		[]*provider.MP3{a, b},
+		[]*provider.MP3{{FileName: "a.mp3", SavePath: "album"}, c, d},
+	)
+	want := []*provider.MP3{a, b, c}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MergeMP3List got: %v, want: %v", got, want)
+	}
+}
@@ -1,12 +1,13 @@
 package handler
 
 import (
+	"context"
 	"fmt"
-	"os"
-	"path/filepath"
 
+	"github.com/winterssy/easylog"
+	"github.com/winterssy/music-get/conf"
+	"github.com/winterssy/music-get/download"
 	"github.com/winterssy/music-get/internal/ecode"
-	"github.com/winterssy/music-get/pkg/concurrency"
 	"github.com/winterssy/music-get/provider"
 )
 
@@ -14,74 +15,90 @@ type (
 	DownloadError struct {
 		FileName string `json:"filename"`
 		URL      string `json:"url,omitempty"`
+		Source   string `json:"source"`
+		Id       string `json:"id,omitempty"`
+		Path     string `json:"path,omitempty"`
 		Code     int    `json:"code"`
 		Reason   string `json:"reason"`
 	}
 )
 
-func SingleDownload(mp3List []*provider.MP3) {
-	total, success, failure, ignore := len(mp3List), 0, 0, 0
+// Download downloads the songs with n workers, then prints the report and returns the tasks in order.
+// The progress is shown as bars if stdout is a terminal, otherwise it's logged periodically.
+func Download(ctx context.Context, mp3List []*provider.MP3, n int) []provider.DownloadTask {
+	view := newProgressView()
+	engine := download.New(n, view)
+	view.start()
+	tasks := engine.Run(ctx, mp3List)
+	view.stop()
+	summarize(tasks)
+	return tasks
+}
 
-	dlErrs := make([]*DownloadError, 0)
-	for _, m := range mp3List {
-		switch status := m.SingleDownload(); status {
+func logEvent(e *download.Event) {
+	switch e.Type {
+	case download.Started:
+		easylog.Infof("Downloading: %s", e.MP3.FileName)
+	case download.Done, download.Failed:
+		switch e.Task.Status {
 		case ecode.Success:
-			success++
-		case ecode.AlreadyDownloaded:
-			ignore++
+			easylog.Infof("Download complete: %s", e.MP3.FileName)
+		case ecode.SongUnavailable, ecode.AlreadyDownloaded, ecode.DownloadedBefore, ecode.DownloadCanceled:
+			easylog.Warnf("Download interrupt: %s: %s", e.MP3.FileName, ecode.Message(e.Task.Status))
 		default:
-			failure++
-			dlErrs = append(dlErrs, &DownloadError{
-				FileName: m.FileName,
-				URL:      m.DownloadURL,
-				Code:     status,
-				Reason:   ecode.Message(status),
-			})
-			if status != ecode.SongUnavailable {
-				// ignore error
-				os.Remove(filepath.Join(m.SavePath, m.FileName))
-			}
+			easylog.Errorf("Download error: %s: %s", e.MP3.FileName, ecode.Message(e.Task.Status))
 		}
 	}
-
-	fmt.Printf("\nDownload report --> total: %d, success: %d, failure: %d, ignore: %d\n", total, success, failure, ignore)
-	outputLog(dlErrs)
 }
 
-func ConcurrentDownload(mp3List []*provider.MP3, n int) {
-	total, success, failure, ignore := len(mp3List), 0, 0, 0
-
-	c := concurrency.New(n)
-	taskList := make(chan provider.DownloadTask, total)
-	for _, i := range mp3List {
-		c.Add(1)
-		go i.ConcurrentDownload(taskList, c)
-	}
-	c.Wait()
-
+// summarize prints the download report, writes the failures into the log file,
+// and writes the report file if required.
+func summarize(tasks []provider.DownloadTask) {
+	fallbacks := make([]*provider.MP3, 0)
 	dlErrs := make([]*DownloadError, 0)
-	for range mp3List {
-		task := <-taskList
+	for _, task := range tasks {
 		switch task.Status {
 		case ecode.Success:
-			success++
-		case ecode.AlreadyDownloaded:
-			ignore++
+			if task.MP3.Origin != nil {
+				fallbacks = append(fallbacks, task.MP3)
+			}
+		case ecode.AlreadyDownloaded, ecode.DownloadedBefore:
+			// not an error
 		default:
-			failure++
-			dlErrs = append(dlErrs, &DownloadError{
+			dlErr := &DownloadError{
 				FileName: task.MP3.FileName,
 				URL:      task.MP3.DownloadURL,
+				Source:   provider.PlatformName(task.MP3.Provider),
+				Path:     task.Path,
 				Code:     task.Status,
 				Reason:   ecode.Message(task.Status),
-			})
-			if task.Status != ecode.SongUnavailable {
-				// ignore error
-				os.Remove(filepath.Join(task.MP3.SavePath, task.MP3.FileName))
 			}
+			if task.MP3.Track != nil {
+				dlErr.Id = task.MP3.Track.Id
+			}
+			dlErrs = append(dlErrs, dlErr)
 		}
 	}
 
-	fmt.Printf("\nDownload report --> total: %d, success: %d, failure: %d, ignore: %d\n", total, success, failure, ignore)
+	report := NewReport(tasks)
+	fmt.Printf("\nDownload report --> total: %d, success: %d, failure: %d, ignore: %d\n",
+		report.Total, report.Success, report.Failure, report.Ignore)
+	printFallbacks(fallbacks)
 	outputLog(dlErrs)
+
+	if conf.Conf.ReportFile != "" {
+		if err := WriteReport(conf.Conf.ReportFile, report); err != nil {
+			easylog.Errorf("Write report failed: %s", err.Error())
+		} else {
+			fmt.Printf("Report saved to %q\n", conf.Conf.ReportFile)
+		}
+	}
+}
+
+// printFallbacks prints the songs downloaded from alternate providers.
+func printFallbacks(fallbacks []*provider.MP3) {
+	for _, m := range fallbacks {
+		fmt.Printf("Fallback --> %s: %s -> %s\n", m.FileName,
+			provider.PlatformName(m.Origin.Provider), provider.PlatformName(m.Provider))
+	}
 }
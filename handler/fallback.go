@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/winterssy/easylog"
+	"github.com/winterssy/music-get/pkg/concurrency"
+	"github.com/winterssy/music-get/provider"
+)
+
+const (
+	// FallbackThreshold is the minimum similarity of a search result to be used as a fallback
+	FallbackThreshold = 0.8
+	// FallbackSearchLimit is the max search results of each platform to match
+	FallbackSearchLimit = 5
+
+	// the durations within the tolerance are regarded as the same,
+	// beyond the max difference they are regarded as different songs
+	durationTolerance = 3 * time.Second
+	maxDurationDiff   = 15 * time.Second
+)
+
+// Fallback searches the unavailable songs of mp3List on the platforms in order, and replaces them
+// with the best matches whose similarity reaches FallbackThreshold.
+func Fallback(ctx context.Context, mp3List []*provider.MP3, platforms []int) {
+	c := concurrency.New(4)
+	for i, m := range mp3List {
+		if (m.Playable && m.DownloadURL != "") || m.Track == nil {
+			continue
+		}
+
+		c.Add(1)
+		go func(i int, m *provider.MP3) {
+			defer c.Done()
+			if alt := fallback(ctx, m, platforms); alt != nil {
+				mp3List[i] = alt
+			}
+		}(i, m)
+	}
+	c.Wait()
+}
+
+func fallback(ctx context.Context, m *provider.MP3, platforms []int) *provider.MP3 {
+	keyword := m.Track.Title
+	if len(m.Track.Artists) > 0 {
+		keyword += " " + m.Track.Artists[0]
+	}
+
+	for _, platform := range platforms {
+		if platform == m.Provider {
+			continue
+		}
+
+		results, err := provider.Search(ctx, platform, keyword, FallbackSearchLimit)
+		if err != nil {
+			easylog.Debugf("Fallback search failed: %s: %s", provider.PlatformName(platform), err.Error())
+			continue
+		}
+
+		var best *provider.SearchResult
+		bestScore := 0.0
+		for _, r := range results {
+			if s := similarity(m.Track, r.Track); s > bestScore {
+				best, bestScore = r, s
+			}
+		}
+		if best == nil || bestScore < FallbackThreshold {
+			continue
+		}
+
+		alt, err := prepareFallback(ctx, m, best)
+		if err != nil {
+			easylog.Debugf("Fallback prepare failed: %s: %s", provider.PlatformName(platform), err.Error())
+			continue
+		}
+		easylog.Infof("Fallback: %s: %s -> %s (similarity %.2f)", m.FileName,
+			provider.PlatformName(m.Provider), provider.PlatformName(platform), bestScore)
+		return alt
+	}
+
+	easylog.Debugf("Fallback not found: %s", m.FileName)
+	return nil
+}
+
+// prepareFallback prepares the matched song, it's saved as m with the metadata of m,
+// except the extension, the bit rate and the id used to fetch lyrics.
+func prepareFallback(ctx context.Context, m *provider.MP3, r *provider.SearchResult) (*provider.MP3, error) {
+	if err := r.Request.Do(ctx); err != nil {
+		return nil, err
+	}
+	mp3List, err := r.Request.Prepare(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(mp3List) == 0 || !mp3List[0].Playable || mp3List[0].DownloadURL == "" {
+		return nil, errors.New("song unavailable")
+	}
+
+	alt := mp3List[0]
+	track := *m.Track
+	track.Id, track.BitRate = alt.Track.Id, alt.Track.BitRate
+	ext := filepath.Ext(alt.FileName)
+	alt.FileName, alt.SavePath, alt.Track, alt.Origin = m.FileName, m.SavePath, &track, m
+	alt.SetExt(ext)
+	return alt, nil
+}
+
+// similarity measures how likely b is the same song as a, from 0 to 1.
+func similarity(a, b *provider.Track) float64 {
+	title := textSimilarity(normalize(a.Title), normalize(b.Title))
+
+	artists := 0.0
+	if len(a.Artists) > 0 {
+		bArtists := normalize(strings.Join(b.Artists, ""))
+		for _, i := range a.Artists {
+			if ar := normalize(i); ar != "" && strings.Contains(bArtists, ar) {
+				artists++
+			}
+		}
+		artists /= float64(len(a.Artists))
+	}
+
+	// neutral if the duration of either is unknown
+	duration := 0.5
+	if a.Duration > 0 && b.Duration > 0 {
+		diff := a.Duration - b.Duration
+		if diff < 0 {
+			diff = -diff
+		}
+		switch {
+		case diff <= durationTolerance:
+			duration = 1
+		case diff >= maxDurationDiff:
+			return 0
+		default:
+			duration = 1 - float64(diff-durationTolerance)/float64(maxDurationDiff-durationTolerance)
+		}
+	}
+
+	return 0.5*title + 0.3*artists + 0.2*duration
+}
+
+// normalize lowercases s and drops the spaces and punctuations.
+func normalize(s string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// textSimilarity returns 1 minus the normalized edit distance between a and b.
+func textSimilarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+
+	prev, cur := make([]int, len(rb)+1), make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	n := len(ra)
+	if len(rb) > n {
+		n = len(rb)
+	}
+	return 1 - float64(prev[len(rb)])/float64(n)
+}
+
+func minInt(a int, others ...int) int {
+	for _, i := range others {
+		if i < a {
+			a = i
+		}
+	}
+	return a
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/winterssy/music-get/provider"
+)
+
+func TestSimilarity(t *testing.T) {
+	a := &provider.Track{Title: "晴天", Artists: []string{"周杰伦"}, Duration: 269 * time.Second}
+	tests := []struct {
+		b     *provider.Track
+		match bool
+	}{
+		{&provider.Track{Title: "晴天", Artists: []string{"周杰伦"}, Duration: 270 * time.Second}, true},
+		{&provider.Track{Title: "晴天 ", Artists: []string{"周杰伦", "Other"}}, true},
+		{&provider.Track{Title: "晴天 (Live)", Artists: []string{"周杰伦"}, Duration: 300 * time.Second}, false},
+		{&provider.Track{Title: "晴天", Artists: []string{"Cover"}, Duration: 269 * time.Second}, false},
+		{&provider.Track{Title: "雨天", Artists: []string{"周杰伦"}, Duration: 269 * time.Second}, false},
+	}
+
+	for _, test := range tests {
+		s := similarity(a, test.b)
+		if (s >= FallbackThreshold) != test.match {
+			t.Errorf("similarity(%v, %v) got: %.2f, want match: %v", a, test.b, s, test.match)
+		}
+	}
+}
+
+func TestTextSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"", "", 1},
+		{"abc", "abc", 1},
+		{"abc", "abd", 1 - 1.0/3},
+		{"晴天", "雨天", 0.5},
+		{"abc", "", 0},
+	}
+
+	for _, test := range tests {
+		if got := textSimilarity(test.a, test.b); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("textSimilarity(%q, %q) got: %.2f, want: %.2f", test.a, test.b, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/winterssy/music-get/pkg/history"
+	"github.com/winterssy/music-get/utils"
+)
+
+const (
+	HistoryFileName = "music-get.history.jsonl"
+)
+
+var (
+	historyCSVHeader = []string{"provider", "id", "title", "path", "size", "hash", "quality", "time"}
+)
+
+// PrintHistory prints the history records as a table.
+func PrintHistory(w io.Writer, records []*history.Record) {
+	for _, r := range records {
+		fmt.Fprintf(w, "%s  %-7s  %-16s  %-9s  %9s  %s\n", r.Time.Local().Format("2006-01-02 15:04"),
+			r.Provider, r.Id, r.Quality, formatBytes(r.Size), r.Path)
+	}
+	fmt.Fprintf(w, "\nHistory --> total: %d\n", len(records))
+}
+
+// ExportHistory writes the history records as CSV with a header if format is ".csv",
+// otherwise as a JSON array.
+func ExportHistory(w io.Writer, records []*history.Record, format string) error {
+	if !strings.EqualFold(format, ReportFormatCSV) {
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "\t")
+		return enc.Encode(records)
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(historyCSVHeader); err != nil {
+		return err
+	}
+	for _, r := range records {
+		err := cw.Write([]string{
+			r.Provider, r.Id, r.Title, r.Path, strconv.FormatInt(r.Size, 10),
+			r.Hash, r.Quality, r.Time.Format(time.RFC3339),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// HistoryPruneFunc matches the records of the missing files if missing is true,
+// or the records before the time if it's not zero.
+func HistoryPruneFunc(missing bool, before time.Time) func(*history.Record) bool {
+	return func(r *history.Record) bool {
+		if !before.IsZero() && r.Time.Before(before) {
+			return true
+		}
+		if missing {
+			exists, err := utils.ExistsPath(r.Path)
+			return !exists && err == nil
+		}
+		return false
+	}
+}
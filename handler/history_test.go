@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/winterssy/music-get/pkg/history"
+)
+
+func TestExportHistory(t *testing.T) {
+	at := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	records := []*history.Record{
+		{Provider: "netease", Id: "1", Title: "a, b", Path: "/a.mp3", Size: 1024, Hash: "sha256:00", Quality: "mp3 320k", Time: at},
+	}
+
+	var buf bytes.Buffer
+	if err := ExportHistory(&buf, records, ".CSV"); err != nil {
+		t.Fatal(err)
+	}
+	want := "provider,id,title,path,size,hash,quality,time\n" +
+		"netease,1,\"a, b\",/a.mp3,1024,sha256:00,mp3 320k,2020-01-02T03:04:05Z\n"
+	if buf.String() != want {
+		t.Errorf("ExportHistory CSV got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := ExportHistory(&buf, records, ".json"); err != nil {
+		t.Fatal(err)
+	}
+	var got []*history.Record
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil || len(got) != 1 || *got[0] != *records[0] {
+		t.Errorf("ExportHistory JSON got %s, %v", buf.String(), err)
+	}
+}
+
+func TestHistoryPruneFunc(t *testing.T) {
+	f, err := ioutil.TempFile("", "music-get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	now := time.Now()
+	exists := &history.Record{Path: f.Name(), Time: now}
+	missing := &history.Record{Path: filepath.Join(filepath.Dir(f.Name()), "music-get-missing.mp3"), Time: now}
+	old := &history.Record{Path: f.Name(), Time: now.Add(-48 * time.Hour)}
+
+	tests := []struct {
+		missing bool
+		before  time.Time
+		want    []bool
+	}{
+		{true, time.Time{}, []bool{false, true, false}},
+		{false, now.Add(-24 * time.Hour), []bool{false, false, true}},
+		{true, now.Add(-24 * time.Hour), []bool{false, true, true}},
+		{false, time.Time{}, []bool{false, false, false}},
+	}
+	for _, test := range tests {
+		f := HistoryPruneFunc(test.missing, test.before)
+		for i, r := range []*history.Record{exists, missing, old} {
+			if got := f(r); got != test.want[i] {
+				t.Errorf("HistoryPruneFunc(%v, %v) of record %d = %v", test.missing, test.before, i, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/winterssy/music-get/conf"
+	"github.com/winterssy/music-get/provider"
+	"github.com/winterssy/music-get/utils"
+)
+
+type (
+	// ListItem describes what would happen to a song in a real run.
+	ListItem struct {
+		Path         string          `json:"path"`
+		Provider     string          `json:"provider"`
+		Playable     bool            `json:"playable"`
+		Format       string          `json:"format"`
+		BitRate      int             `json:"bitRate,omitempty"`
+		Exists       bool            `json:"exists"`
+		FallbackFrom string          `json:"fallbackFrom,omitempty"`
+		URL          string          `json:"url,omitempty"`
+		Track        *provider.Track `json:"track,omitempty"`
+	}
+)
+
+// NewListItem resolves the target path and the state of m without downloading,
+// m exists if it's in the download history as well.
+func NewListItem(m *provider.MP3) *ListItem {
+	path := filepath.Join(conf.Conf.DownloadDir, m.SavePath, m.FileName)
+	exists, _ := utils.ExistsPath(path)
+	if !exists {
+		_, exists = provider.HistoryRecord(m)
+	}
+	item := &ListItem{
+		Path:     path,
+		Provider: provider.PlatformName(m.Provider),
+		Playable: m.Playable && m.DownloadURL != "",
+		Format:   strings.TrimPrefix(filepath.Ext(m.FileName), "."),
+		Exists:   exists,
+		URL:      m.DownloadURL,
+		Track:    m.Track,
+	}
+	if m.Track != nil {
+		item.BitRate = m.Track.BitRate
+	}
+	if m.Origin != nil {
+		item.FallbackFrom = provider.PlatformName(m.Origin.Provider)
+	}
+	return item
+}
+
+// PrintMP3List prints the resolved songs for the dry run, as a JSON array if asJSON is true.
+func PrintMP3List(w io.Writer, mp3List []*provider.MP3, asJSON bool) error {
+	items := make([]*ListItem, 0, len(mp3List))
+	for _, m := range mp3List {
+		items = append(items, NewListItem(m))
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "\t")
+		return enc.Encode(items)
+	}
+
+	playable, exists := 0, 0
+	for _, i := range items {
+		state := "unavailable"
+		switch {
+		case i.Playable && i.Exists:
+			state, exists, playable = "exists", exists+1, playable+1
+		case i.Playable:
+			state, playable = "ok", playable+1
+		}
+
+		quality := i.Format
+		if i.BitRate > 0 {
+			quality = fmt.Sprintf("%s %dk", i.Format, i.BitRate)
+		}
+		source := i.Provider
+		if i.FallbackFrom != "" {
+			source = i.FallbackFrom + "->" + i.Provider
+		}
+		fmt.Fprintf(w, "%-11s  %-9s  %-14s  %s\n", state, quality, source, i.Path)
+	}
+	_, err := fmt.Fprintf(w, "\nDry run --> total: %d, playable: %d, unavailable: %d, exists: %d\n",
+		len(items), playable, len(items)-playable, exists)
+	return err
+}
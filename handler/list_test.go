@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/winterssy/music-get/conf"
+	"github.com/winterssy/music-get/provider"
+)
+
+func TestPrintMP3List(t *testing.T) {
+	dir, err := ioutil.TempDir("", "music-get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conf.Conf.DownloadDir = dir
+
+	if err = ioutil.WriteFile(filepath.Join(dir, "a.mp3"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	origin := &provider.MP3{FileName: "b.mp3", SavePath: "album", Provider: provider.NetEaseMusic}
+	mp3List := []*provider.MP3{
+		{FileName: "a.mp3", SavePath: ".", Playable: true, DownloadURL: "http://a", Track: &provider.Track{BitRate: 320}},
+		{FileName: "b.flac", SavePath: "album", Playable: true, DownloadURL: "http://b", Provider: provider.QQMusic, Origin: origin},
+		{FileName: "c.mp3", SavePath: "album"},
+	}
+
+	var buf bytes.Buffer
+	if err = PrintMP3List(&buf, mp3List, true); err != nil {
+		t.Fatal(err)
+	}
+
+	var items []*ListItem
+	if err = json.Unmarshal(buf.Bytes(), &items); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("PrintMP3List got %d items, want: 3", len(items))
+	}
+
+	tests := []struct {
+		path         string
+		playable     bool
+		exists       bool
+		format       string
+		fallbackFrom string
+	}{
+		{filepath.Join(dir, "a.mp3"), true, true, "mp3", ""},
+		{filepath.Join(dir, "album", "b.flac"), true, false, "flac", "netease"},
+		{filepath.Join(dir, "album", "c.mp3"), false, false, "mp3", ""},
+	}
+	for i, test := range tests {
+		got := items[i]
+		if got.Path != test.path || got.Playable != test.playable || got.Exists != test.exists ||
+			got.Format != test.format || got.FallbackFrom != test.fallbackFrom {
+			t.Errorf("PrintMP3List item %d got: %+v, want: %+v", i, got, test)
+		}
+	}
+	if items[0].BitRate != 320 {
+		t.Errorf("PrintMP3List item 0 bit rate got: %d, want: 320", items[0].BitRate)
+	}
+}
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/winterssy/music-get/pkg/pathtemplate"
+	"github.com/winterssy/music-get/provider"
+	"github.com/winterssy/music-get/utils"
+)
+
+var (
+	// templateFields are the fields available in the output template
+	templateFields = map[string]func(m *provider.MP3) interface{}{
+		"title":       func(m *provider.MP3) interface{} { return m.Track.Title },
+		"artist":      func(m *provider.MP3) interface{} { return strings.Join(m.Track.Artists, ", ") },
+		"albumartist": func(m *provider.MP3) interface{} { return m.Track.AlbumArtistOrDefault() },
+		"album":       func(m *provider.MP3) interface{} { return m.Track.Album },
+		"year":        func(m *provider.MP3) interface{} { return m.Track.Year() },
+		"track":       func(m *provider.MP3) interface{} { return m.Track.TrackNumber },
+		"disc":        func(m *provider.MP3) interface{} { return m.Track.DiscNumber },
+		"id":          func(m *provider.MP3) interface{} { return m.Track.Id },
+		"provider":    func(m *provider.MP3) interface{} { return provider.PlatformName(m.Provider) },
+		"ext":         func(m *provider.MP3) interface{} { return strings.TrimPrefix(filepath.Ext(m.FileName), ".") },
+	}
+)
+
+// ParseOutputTemplate parses the template of the save path relative to the download directory,
+// such as "{albumartist}/{year} - {album}/{disc:02}-{track:02} {title}.{ext}".
+func ParseOutputTemplate(s string) (*pathtemplate.Template, error) {
+	t, err := pathtemplate.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range t.Fields() {
+		if _, ok := templateFields[i]; !ok {
+			return nil, fmt.Errorf("unknown template field: {%s}", i)
+		}
+	}
+	return t, nil
+}
+
+// ApplyTemplate names the songs by the template. Different songs named the same are numbered as
+// "name (2).ext" in the order of their keys, so that the names don't depend on the order of the list.
+func ApplyTemplate(mp3List []*provider.MP3, t *pathtemplate.Template) {
+	groups := make(map[string][]*provider.MP3)
+	for _, m := range mp3List {
+		if m.Track == nil {
+			continue
+		}
+		m.SavePath, m.FileName = renderPath(m, t)
+		id := pathID(m.SavePath, m.FileName)
+		groups[id] = append(groups[id], m)
+	}
+
+	ids := make([]string, 0, len(groups))
+	for id := range groups {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	used := make(map[string]bool, len(groups))
+	for _, id := range ids {
+		used[id] = true
+	}
+	for _, id := range ids {
+		group := groups[id]
+		if len(group) < 2 {
+			continue
+		}
+
+		sort.SliceStable(group, func(i, j int) bool {
+			return group[i].Key() < group[j].Key()
+		})
+		for _, m := range group[1:] {
+			ext := filepath.Ext(m.FileName)
+			base := strings.TrimSuffix(m.FileName, ext)
+			for n := 2; ; n++ {
+				name := fmt.Sprintf("%s (%d)%s", base, n, ext)
+				if id := pathID(m.SavePath, name); !used[id] {
+					used[id] = true
+					m.FileName = name
+					break
+				}
+			}
+		}
+	}
+}
+
+// renderPath executes the template with the sanitized metadata of m,
+// and returns the directory relative to the download directory and the file name.
+func renderPath(m *provider.MP3, t *pathtemplate.Template) (string, string) {
+	values := make(map[string]interface{}, len(templateFields))
+	hasExt := false
+	for _, field := range t.Fields() {
+		v := templateFields[field](m)
+		if s, ok := v.(string); ok {
+			v = utils.TrimInvalidFilePathChars(s)
+		}
+		values[field] = v
+		hasExt = hasExt || field == "ext"
+	}
+
+	p := t.Execute(values)
+	ext := filepath.Ext(m.FileName)
+	if !hasExt {
+		p += ext
+	}
+
+	segments := make([]string, 0)
+	for _, i := range strings.FieldsFunc(p, func(r rune) bool {
+		return r == '/' || r == filepath.Separator
+	}) {
+		// sanitize again since the literal text counts, and the joined values may be too long
+		if i = utils.TrimInvalidFilePathChars(i); i != "" {
+			segments = append(segments, i)
+		}
+	}
+
+	// keep the original name if the template renders nothing but the extension
+	n := len(segments)
+	switch {
+	case n == 0:
+		segments = append(segments, m.FileName)
+	case strings.TrimSpace(strings.TrimSuffix(segments[n-1], ext)) == "":
+		segments[n-1] = m.FileName
+	}
+
+	n = len(segments)
+	return filepath.Join(append([]string{"."}, segments[:n-1]...)...), segments[n-1]
+}
+
+// pathID identifies a path regardless of case, since some file systems are case-insensitive.
+func pathID(dir, name string) string {
+	return strings.ToLower(filepath.Join(dir, name))
+}
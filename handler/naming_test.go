@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/winterssy/music-get/provider"
+)
+
+func TestParseOutputTemplate(t *testing.T) {
+	if _, err := ParseOutputTemplate("{albumartist}/{year} - {album}/{disc:02}-{track:02} {title}.{ext}"); err != nil {
+		t.Error(err)
+	}
+	if _, err := ParseOutputTemplate("{composer}/{title}"); err == nil {
+		t.Error("ParseOutputTemplate with unknown field should fail")
+	}
+}
+
+func TestApplyTemplate(t *testing.T) {
+	tmpl, err := ParseOutputTemplate("{albumartist}/{year} - {album}/{disc:02}-{track:02} {title}.{ext}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	song := func(id, title string, track int) *provider.MP3 {
+		return &provider.MP3{
+			FileName: "legacy.flac",
+			SavePath: "legacy",
+			Provider: provider.QQMusic,
+			Track: &provider.Track{
+				Id:          id,
+				Title:       title,
+				Artists:     []string{"周杰伦"},
+				Album:       "叶惠美",
+				TrackNumber: track,
+				DiscNumber:  1,
+				ReleaseDate: time.Date(2003, 7, 31, 0, 0, 0, 0, time.Local),
+			},
+		}
+	}
+	a, b, c := song("002", "晴天", 3), song("001", "晴天", 3), song("003", "../a/b", 4)
+	noTrack := &provider.MP3{FileName: "x.mp3", SavePath: "y"}
+	ApplyTemplate([]*provider.MP3{a, b, c, noTrack}, tmpl)
+
+	dir := filepath.Join("周杰伦", "2003 - 叶惠美")
+	tests := []struct {
+		m        *provider.MP3
+		savePath string
+		fileName string
+	}{
+		// collisions are numbered in the order of keys
+		{b, dir, "01-03 晴天.flac"},
+		{a, dir, "01-03 晴天 (2).flac"},
+		{noTrack, "y", "x.mp3"},
+	}
+	for _, test := range tests {
+		if test.m.SavePath != test.savePath || test.m.FileName != test.fileName {
+			t.Errorf("ApplyTemplate got: %s, want: %s",
+				filepath.Join(test.m.SavePath, test.m.FileName), filepath.Join(test.savePath, test.fileName))
+		}
+	}
+	if c.SavePath != dir || filepath.Base(c.FileName) != c.FileName {
+		t.Errorf("ApplyTemplate should sanitize the metadata, got: %s", filepath.Join(c.SavePath, c.FileName))
+	}
+
+	tmpl, _ = ParseOutputTemplate("{album}/{title}")
+	m := song("001", "", 1)
+	ApplyTemplate([]*provider.MP3{m}, tmpl)
+	if m.SavePath != "叶惠美" || m.FileName != "legacy.flac" {
+		t.Errorf("ApplyTemplate with empty name got: %s", filepath.Join(m.SavePath, m.FileName))
+	}
+}
@@ -2,8 +2,10 @@ package handler
 
 import (
 	"errors"
+	"fmt"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/winterssy/easylog"
 	"github.com/winterssy/music-get/provider"
@@ -166,3 +168,16 @@ func parseKuwo(url string) (req provider.MusicRequest, err error) {
 
 	return
 }
+
+// ParsePlatforms parses the platform names, such as "qq" and "kuwo".
+func ParsePlatforms(names []string) ([]int, error) {
+	platforms := make([]int, 0, len(names))
+	for _, name := range names {
+		platform, ok := provider.ParsePlatform(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("unsupported platform: %s", name)
+		}
+		platforms = append(platforms, platform)
+	}
+	return platforms, nil
+}
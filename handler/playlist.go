@@ -0,0 +1,220 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/winterssy/easylog"
+	"github.com/winterssy/music-get/conf"
+	"github.com/winterssy/music-get/internal/ecode"
+	"github.com/winterssy/music-get/provider"
+	"github.com/winterssy/music-get/utils"
+)
+
+// Playlist file formats.
+const (
+	PlaylistM3U8 = "m3u8"
+	PlaylistXSPF = "xspf"
+)
+
+type (
+	// Playlist is the songs of an album or a playlist in the order of the platform.
+	Playlist struct {
+		Title string
+		// Dir is the directory of the playlist files relative to the download directory
+		Dir   string
+		Songs []*provider.MP3
+	}
+
+	// PlaylistEntry is a song of a playlist which is on disk.
+	PlaylistEntry struct {
+		// Path is relative to the directory of the playlist, slash separated
+		Path     string
+		Title    string
+		Artist   string
+		Album    string
+		Duration time.Duration
+	}
+
+	xspfPlaylist struct {
+		XMLName xml.Name    `xml:"playlist"`
+		Version string      `xml:"version,attr"`
+		Xmlns   string      `xml:"xmlns,attr"`
+		Title   string      `xml:"title,omitempty"`
+		Tracks  []xspfTrack `xml:"trackList>track"`
+	}
+
+	xspfTrack struct {
+		Location string `xml:"location"`
+		Title    string `xml:"title,omitempty"`
+		Creator  string `xml:"creator,omitempty"`
+		Album    string `xml:"album,omitempty"`
+		Duration int64  `xml:"duration,omitempty"`
+	}
+)
+
+// NewPlaylist returns the playlist of the prepared songs, saved into the directory of the first song.
+// It should be called before the save paths are changed by ApplyTemplate.
+func NewPlaylist(title string, mp3List []*provider.MP3) *Playlist {
+	p := &Playlist{Title: title, Songs: append([]*provider.MP3(nil), mp3List...)}
+	if len(mp3List) > 0 {
+		p.Dir = mp3List[0].SavePath
+	}
+	if p.Title == "" {
+		p.Title = filepath.Base(p.Dir)
+	}
+	return p
+}
+
+// Entries returns the songs which are downloaded or skipped as already downloaded in the playlist order.
+// A song is matched by its own task, the task of its fallback, or the task of the same song merged
+// from another request.
+func (p *Playlist) Entries(tasks []provider.DownloadTask) []*PlaylistEntry {
+	byMP3 := make(map[*provider.MP3]*provider.DownloadTask, len(tasks))
+	byKey := make(map[string]*provider.DownloadTask, len(tasks))
+	for i := range tasks {
+		task := &tasks[i]
+		if task.Status != ecode.Success && task.Status != ecode.AlreadyDownloaded {
+			continue
+		}
+		for m := task.MP3; m != nil; m = m.Origin {
+			byMP3[m] = task
+			if key := m.Key(); key != "" {
+				byKey[key] = task
+			}
+		}
+	}
+
+	dir := filepath.Join(conf.Conf.DownloadDir, p.Dir)
+	entries := make([]*PlaylistEntry, 0, len(p.Songs))
+	for _, m := range p.Songs {
+		task, ok := byMP3[m]
+		if !ok {
+			if task, ok = byKey[m.Key()]; !ok {
+				continue
+			}
+		}
+		rel, err := filepath.Rel(dir, task.Path)
+		if err != nil {
+			continue
+		}
+
+		e := &PlaylistEntry{Path: filepath.ToSlash(rel)}
+		if t := task.MP3.Track; t != nil {
+			e.Title, e.Artist, e.Album, e.Duration = t.Title, strings.Join(t.Artists, ", "), t.Album, t.Duration
+		}
+		if e.Title == "" {
+			e.Title = strings.TrimSuffix(filepath.Base(task.Path), filepath.Ext(task.Path))
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// WriteM3U8 writes the entries as an extended M3U playlist in UTF-8.
+func WriteM3U8(w io.Writer, title string, entries []*PlaylistEntry) error {
+	var buf bytes.Buffer
+	buf.WriteString("#EXTM3U\n")
+	if title != "" {
+		fmt.Fprintf(&buf, "#PLAYLIST:%s\n", title)
+	}
+	for _, e := range entries {
+		// -1 means the duration is unknown
+		sec := int64(-1)
+		if e.Duration > 0 {
+			sec = int64(e.Duration.Round(time.Second) / time.Second)
+		}
+		name := e.Title
+		if e.Artist != "" {
+			name = e.Artist + " - " + e.Title
+		}
+		fmt.Fprintf(&buf, "#EXTINF:%d,%s\n%s\n", sec, name, e.Path)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// WriteXSPF writes the entries as an XSPF playlist, the locations are relative URIs.
+func WriteXSPF(w io.Writer, title string, entries []*PlaylistEntry) error {
+	p := &xspfPlaylist{
+		Version: "1",
+		Xmlns:   "http://xspf.org/ns/0/",
+		Title:   title,
+		Tracks:  make([]xspfTrack, 0, len(entries)),
+	}
+	for _, e := range entries {
+		p.Tracks = append(p.Tracks, xspfTrack{
+			Location: (&url.URL{Path: e.Path}).String(),
+			Title:    e.Title,
+			Creator:  e.Artist,
+			Album:    e.Album,
+			Duration: int64(e.Duration / time.Millisecond),
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	if err := enc.Encode(p); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// SavePlaylists writes the playlist files of the formats into the playlist directories after the download,
+// errors are logged only. Nothing is written for a playlist without any song on disk.
+func SavePlaylists(playlists []*Playlist, tasks []provider.DownloadTask, formats []string) {
+	for _, p := range playlists {
+		entries := p.Entries(tasks)
+		if len(entries) == 0 {
+			continue
+		}
+		for _, format := range formats {
+			fPath, err := p.Save(entries, format)
+			if err != nil {
+				easylog.Errorf("Save playlist failed: %s: %s", p.Title, err.Error())
+				continue
+			}
+			easylog.Infof("Playlist saved: %s", fPath)
+		}
+	}
+}
+
+// Save writes the entries as the playlist file of the format, and returns the file path.
+func (p *Playlist) Save(entries []*PlaylistEntry, format string) (string, error) {
+	var write func(io.Writer, string, []*PlaylistEntry) error
+	switch format {
+	case PlaylistM3U8:
+		write = WriteM3U8
+	case PlaylistXSPF:
+		write = WriteXSPF
+	default:
+		return "", fmt.Errorf("unknown playlist format: %q", format)
+	}
+
+	name := utils.TrimInvalidFilePathChars(p.Title)
+	if name == "" {
+		name = "playlist"
+	}
+	dir := filepath.Join(conf.Conf.DownloadDir, p.Dir)
+	if err := utils.BuildPathIfNotExist(dir); err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := write(&buf, p.Title, entries); err != nil {
+		return "", err
+	}
+	fPath := filepath.Join(dir, name+"."+format)
+	return fPath, ioutil.WriteFile(fPath, buf.Bytes(), 0644)
+}
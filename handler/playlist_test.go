@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/winterssy/music-get/conf"
+	"github.com/winterssy/music-get/internal/ecode"
+	"github.com/winterssy/music-get/provider"
+)
+
+func TestPlaylist_Entries(t *testing.T) {
+	conf.Conf.DownloadDir = filepath.FromSlash("/music")
+	a, b, c, d, e := testSong("1", "a"), testSong("2", "b"), testSong("3", "c"), testSong("4", "d"), testSong("5", "e")
+	for _, m := range []*provider.MP3{a, b, c, d, e} {
+		m.SavePath = "list"
+	}
+	a.Track.Artists, a.Track.Duration = []string{"x", "y"}, 200500*time.Millisecond
+	p := NewPlaylist("My List", []*provider.MP3{a, b, c, d, e})
+
+	// b is merged into the same song of another request, c is replaced by a fallback, d failed,
+	// e is downloaded before but moved out of band
+	dup := testSong("2", "b")
+	alt := &provider.MP3{Provider: provider.QQMusic, Track: &provider.Track{Id: "003", Title: "c"}, Origin: c}
+	path := func(s string) string {
+		return filepath.FromSlash("/music/" + s)
+	}
+	tasks := []provider.DownloadTask{
+		{MP3: alt, Status: ecode.Success, Path: path("list/c.flac")},
+		{MP3: a, Status: ecode.AlreadyDownloaded, Path: path("list/a.mp3")},
+		{MP3: dup, Status: ecode.Success, Path: path("other/b.mp3")},
+		{MP3: d, Status: ecode.HTTPRequestException, Path: path("list/d.mp3")},
+		{MP3: e, Status: ecode.DownloadedBefore, Path: path("list/e.mp3")},
+	}
+
+	entries := p.Entries(tasks)
+	got := make([]string, 0, len(entries))
+	for _, e := range entries {
+		got = append(got, e.Path)
+	}
+	if want := "a.mp3 ../other/b.mp3 c.flac"; strings.Join(got, " ") != want {
+		t.Fatalf("Entries got %v, want %s", got, want)
+	}
+	if e := entries[0]; e.Title != "a" || e.Artist != "x, y" || e.Duration != 200500*time.Millisecond {
+		t.Errorf("Entries got %+v", e)
+	}
+}
+
+func TestWriteM3U8(t *testing.T) {
+	entries := []*PlaylistEntry{
+		{Path: "x - a.mp3", Title: "a", Artist: "x", Duration: 200500 * time.Millisecond},
+		{Path: "../other/b.flac", Title: "b"},
+	}
+	var buf bytes.Buffer
+	if err := WriteM3U8(&buf, "My List", entries); err != nil {
+		t.Fatal(err)
+	}
+	want := "#EXTM3U\n#PLAYLIST:My List\n#EXTINF:201,x - a\nx - a.mp3\n#EXTINF:-1,b\n../other/b.flac\n"
+	if buf.String() != want {
+		t.Errorf("WriteM3U8 got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestWriteXSPF(t *testing.T) {
+	entries := []*PlaylistEntry{
+		{Path: "x: a&b #1.mp3", Title: "a&b", Artist: "x", Album: "z", Duration: 200500 * time.Millisecond},
+	}
+	var buf bytes.Buffer
+	if err := WriteXSPF(&buf, "My List", entries); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		`<playlist version="1" xmlns="http://xspf.org/ns/0/">`,
+		"<title>My List</title>",
+		"<location>./x:%20a&amp;b%20%231.mp3</location>",
+		"<title>a&amp;b</title>",
+		"<creator>x</creator>",
+		"<album>z</album>",
+		"<duration>200500</duration>",
+	} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("WriteXSPF got:\n%s\nmissing %s", buf.String(), s)
+		}
+	}
+}
+
+func TestPlaylist_Save(t *testing.T) {
+	dir, err := ioutil.TempDir("", "music-get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conf.Conf.DownloadDir = dir
+
+	p := &Playlist{Title: "a/b?", Dir: "list"}
+	fPath, err := p.Save([]*PlaylistEntry{{Path: "a.mp3", Title: "a"}}, PlaylistM3U8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(fPath) != filepath.Join(dir, "list") || !strings.HasPrefix(filepath.Base(fPath), "ab") ||
+		!strings.HasSuffix(fPath, ".m3u8") {
+		t.Errorf("Save got path %q", fPath)
+	}
+	if _, err = p.Save(nil, "pls"); err == nil {
+		t.Error("Save with unknown format should fail")
+	}
+}
@@ -0,0 +1,308 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cheggaaa/pb/v3"
+	"github.com/winterssy/easylog"
+	"github.com/winterssy/music-get/download"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	// ProgressLogInterval is how often the progress is logged if stdout is not a terminal
+	ProgressLogInterval = 5 * time.Second
+
+	progressRefreshRate = 200 * time.Millisecond
+	progressNameWidth   = 30
+	defaultTermWidth    = 100
+
+	taskBarTemplate  = `{{string . "prefix"}}{{counters . }} {{bar . }} {{percent . }} {{speed . }} {{rtime . "ETA %s"}}`
+	totalBarTemplate = `{{string . "prefix"}}{{counters . }} {{bar . }} {{percent . }}{{string . "suffix"}}`
+)
+
+type (
+	// progressView displays the progress of the engine until stopped, and logs the result of each song.
+	progressView interface {
+		download.Observer
+		start()
+		stop()
+	}
+
+	// multiBar redraws a bar per downloading song and an overall bar in place,
+	// the log output is written above the bars while they are shown.
+	multiBar struct {
+		mu    sync.Mutex
+		out   io.Writer
+		log   io.Writer
+		width int
+		total *pb.ProgressBar
+		tasks []*taskBar
+		// bytes is the size of the finished songs
+		bytes int64
+		// lines is the number of lines drawn last time
+		lines int
+		done  chan struct{}
+		wg    sync.WaitGroup
+	}
+
+	taskBar struct {
+		index int
+		bar   *pb.ProgressBar
+	}
+
+	// progressLog logs the progress periodically, for the output which can't be redrawn.
+	progressLog struct {
+		mu       sync.Mutex
+		interval time.Duration
+		total    int
+		finished int
+		bytes    int64
+		tasks    map[int]*taskProgress
+		done     chan struct{}
+		wg       sync.WaitGroup
+	}
+
+	taskProgress struct {
+		name    string
+		current int64
+		total   int64
+	}
+)
+
+// newProgressView returns the bars if stdout is a terminal, otherwise the periodic log.
+func newProgressView() progressView {
+	fd := int(os.Stdout.Fd())
+	if !terminal.IsTerminal(fd) {
+		return newProgressLog(ProgressLogInterval)
+	}
+
+	width, _, err := terminal.GetSize(fd)
+	if err != nil || width <= 0 {
+		width = defaultTermWidth
+	}
+	return newMultiBar(os.Stdout, os.Stderr, width)
+}
+
+func newMultiBar(out, log io.Writer, width int) *multiBar {
+	total := pb.New(0).SetTemplateString(totalBarTemplate).SetWidth(width).
+		Set(pb.Static, true).Set("prefix", pad("Total", progressNameWidth)+" ")
+	return &multiBar{
+		out:   out,
+		log:   log,
+		width: width,
+		total: total.Start(),
+		done:  make(chan struct{}),
+	}
+}
+
+func (b *multiBar) Notify(e *download.Event) {
+	b.mu.Lock()
+	switch e.Type {
+	case download.Queued:
+		b.total.SetTotal(b.total.Total() + 1)
+	case download.Started:
+		bar := pb.New64(0).SetTemplateString(taskBarTemplate).SetWidth(b.width).
+			Set(pb.Static, true).Set(pb.Bytes, true).Set("prefix", pad(e.MP3.FileName, progressNameWidth)+" ")
+		b.tasks = append(b.tasks, &taskBar{index: e.Index, bar: bar.Start()})
+	case download.Progress:
+		if t := b.task(e.Index); t != nil {
+			t.bar.SetTotal(e.Total)
+			t.bar.SetCurrent(e.Current)
+		}
+	case download.Done, download.Failed:
+		for i, t := range b.tasks {
+			if t.index == e.Index {
+				b.tasks = append(b.tasks[:i], b.tasks[i+1:]...)
+				break
+			}
+		}
+		b.bytes += e.Task.Bytes
+		b.total.Increment()
+	}
+	b.mu.Unlock()
+
+	// the result goes through Write, which redraws the bars below it
+	if e.Type == download.Done || e.Type == download.Failed {
+		logEvent(e)
+	}
+}
+
+// Write writes p above the bars and redraws them, it's the output of the logger while the bars are shown.
+func (b *multiBar) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.clear()
+	n, err := b.log.Write(p)
+	b.draw()
+	return n, err
+}
+
+func (b *multiBar) task(index int) *taskBar {
+	for _, t := range b.tasks {
+		if t.index == index {
+			return t
+		}
+	}
+	return nil
+}
+
+func (b *multiBar) start() {
+	easylog.SetOutput(b)
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		ticker := time.NewTicker(progressRefreshRate)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				b.mu.Lock()
+				b.draw()
+				b.mu.Unlock()
+			case <-b.done:
+				return
+			}
+		}
+	}()
+}
+
+// stop draws the final state and leaves it on the screen.
+func (b *multiBar) stop() {
+	close(b.done)
+	b.wg.Wait()
+	// restored before locking, the logger calls Write with its own lock held
+	easylog.SetOutput(b.log)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.draw()
+}
+
+// clear moves the cursor back to the first line drawn last time and erases the bars.
+func (b *multiBar) clear() {
+	if b.lines > 0 {
+		fmt.Fprintf(b.out, "\x1b[%dA\r\x1b[J", b.lines)
+		b.lines = 0
+	}
+}
+
+func (b *multiBar) draw() {
+	bytes := b.bytes
+	for _, t := range b.tasks {
+		bytes += t.bar.Current()
+	}
+	b.total.Set("suffix", " "+formatBytes(bytes))
+
+	var sb strings.Builder
+	for _, t := range b.tasks {
+		sb.WriteString(t.bar.String())
+		sb.WriteString("\n")
+	}
+	sb.WriteString(b.total.String())
+	sb.WriteString("\n")
+
+	b.clear()
+	io.WriteString(b.out, sb.String())
+	b.lines = len(b.tasks) + 1
+}
+
+func newProgressLog(interval time.Duration) *progressLog {
+	return &progressLog{
+		interval: interval,
+		tasks:    make(map[int]*taskProgress),
+		done:     make(chan struct{}),
+	}
+}
+
+func (l *progressLog) Notify(e *download.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch e.Type {
+	case download.Queued:
+		l.total++
+	case download.Started:
+		logEvent(e)
+		l.tasks[e.Index] = &taskProgress{name: e.MP3.FileName, total: -1}
+	case download.Progress:
+		if t, ok := l.tasks[e.Index]; ok {
+			t.current, t.total = e.Current, e.Total
+		}
+	case download.Done, download.Failed:
+		logEvent(e)
+		delete(l.tasks, e.Index)
+		l.finished++
+		l.bytes += e.Task.Bytes
+	}
+}
+
+func (l *progressLog) start() {
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		ticker := time.NewTicker(l.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				easylog.Info(l.String())
+			case <-l.done:
+				return
+			}
+		}
+	}()
+}
+
+func (l *progressLog) stop() {
+	close(l.done)
+	l.wg.Wait()
+}
+
+// String returns the progress such as "Progress: 3/10 tracks, 12.5 MB; a.mp3 45%, b.mp3 3.2 MB".
+func (l *progressLog) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bytes := l.bytes
+	indexes := make([]int, 0, len(l.tasks))
+	for i, t := range l.tasks {
+		bytes += t.current
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	s := fmt.Sprintf("Progress: %d/%d tracks, %s", l.finished, l.total, formatBytes(bytes))
+	items := make([]string, 0, len(indexes))
+	for _, i := range indexes {
+		t := l.tasks[i]
+		if t.total > 0 {
+			items = append(items, fmt.Sprintf("%s %d%%", t.name, t.current*100/t.total))
+		} else {
+			items = append(items, fmt.Sprintf("%s %s", t.name, formatBytes(t.current)))
+		}
+	}
+	if len(items) > 0 {
+		s += "; " + strings.Join(items, ", ")
+	}
+	return s
+}
+
+// formatBytes formats n in binary units, such as "3.2 MB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for i := n / unit; i >= unit; i /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/winterssy/easylog"
+	"github.com/winterssy/music-get/download"
+	"github.com/winterssy/music-get/internal/ecode"
+	"github.com/winterssy/music-get/provider"
+)
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KB"},
+		{3355443, "3.2 MB"},
+		{5 << 30, "5.0 GB"},
+	}
+
+	for _, test := range tests {
+		if got := formatBytes(test.n); got != test.want {
+			t.Errorf("formatBytes(%d) got: %q, want: %q", test.n, got, test.want)
+		}
+	}
+}
+
+func TestProgressLog(t *testing.T) {
+	a, b, c := &provider.MP3{FileName: "a.mp3"}, &provider.MP3{FileName: "b.mp3"}, &provider.MP3{FileName: "c.mp3"}
+	l := newProgressLog(ProgressLogInterval)
+	events := []*download.Event{
+		{Type: download.Queued, Index: 0, MP3: a},
+		{Type: download.Queued, Index: 1, MP3: b},
+		{Type: download.Queued, Index: 2, MP3: c},
+		{Type: download.Started, Index: 0, MP3: a},
+		{Type: download.Started, Index: 2, MP3: c},
+		{Type: download.Started, Index: 1, MP3: b},
+		{Type: download.Progress, Index: 1, MP3: b, Current: 512, Total: 2048},
+		{Type: download.Progress, Index: 2, MP3: c, Current: 2048, Total: -1},
+		{Type: download.Done, Index: 0, MP3: a, Task: &provider.DownloadTask{Status: ecode.Success, Bytes: 1024}},
+	}
+	for _, e := range events {
+		l.Notify(e)
+	}
+
+	want := "Progress: 1/3 tracks, 3.5 KB; b.mp3 25%, c.mp3 2.0 KB"
+	if got := l.String(); got != want {
+		t.Errorf("progressLog got: %q, want: %q", got, want)
+	}
+}
+
+func TestMultiBar(t *testing.T) {
+	a, b := &provider.MP3{FileName: "a.mp3"}, &provider.MP3{FileName: "b.mp3"}
+	var buf, logs bytes.Buffer
+	bar := newMultiBar(&buf, &logs, 80)
+	events := []*download.Event{
+		{Type: download.Queued, Index: 0, MP3: a},
+		{Type: download.Queued, Index: 1, MP3: b},
+		{Type: download.Started, Index: 0, MP3: a},
+		{Type: download.Started, Index: 1, MP3: b},
+		{Type: download.Progress, Index: 0, MP3: a, Current: 512, Total: 1024},
+	}
+	for _, e := range events {
+		bar.Notify(e)
+	}
+
+	bar.draw()
+	out := buf.String()
+	if bar.lines != 3 || strings.Count(out, "\n") != 3 || !strings.Contains(out, "a.mp3") || !strings.Contains(out, "b.mp3") {
+		t.Fatalf("multiBar drew: %q", out)
+	}
+
+	// the log output is written between clearing and redrawing the bars
+	easylog.SetOutput(bar)
+	defer easylog.SetOutput(os.Stderr)
+	buf.Reset()
+	bar.Notify(&download.Event{Type: download.Done, Index: 0, MP3: a,
+		Task: &provider.DownloadTask{Status: ecode.Success, Bytes: 1024}})
+	out = buf.String()
+	if !strings.HasPrefix(out, "\x1b[3A\r\x1b[J") || bar.lines != 2 || strings.Contains(out, "a.mp3") {
+		t.Errorf("multiBar redrew: %q", out)
+	}
+	if !strings.Contains(logs.String(), "Download complete: a.mp3") {
+		t.Errorf("multiBar logged: %q", logs.String())
+	}
+
+	buf.Reset()
+	logs.Reset()
+	easylog.Warn("retrying")
+	if out = buf.String(); !strings.HasPrefix(out, "\x1b[2A\r\x1b[J") || bar.lines != 2 || !strings.Contains(logs.String(), "retrying") {
+		t.Errorf("multiBar redrew around the log: %q, %q", out, logs.String())
+	}
+	if bar.total.Current() != 1 || bar.total.Total() != 2 {
+		t.Errorf("multiBar total got: %d/%d", bar.total.Current(), bar.total.Total())
+	}
+}
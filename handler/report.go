@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/winterssy/music-get/internal/ecode"
+	"github.com/winterssy/music-get/provider"
+)
+
+const (
+	ReportFormatCSV = ".csv"
+)
+
+var (
+	reportCSVHeader = []string{
+		"status", "message", "provider", "id", "title", "artists",
+		"path", "bytes", "durationMs", "url", "fallbackFrom",
+	}
+)
+
+type (
+	// Report is the machine-readable result of a run, a record per track.
+	Report struct {
+		CreatedAt time.Time       `json:"createdAt"`
+		Total     int             `json:"total"`
+		Success   int             `json:"success"`
+		Failure   int             `json:"failure"`
+		Ignore    int             `json:"ignore"`
+		Tracks    []*ReportRecord `json:"tracks"`
+	}
+
+	ReportRecord struct {
+		Status       int    `json:"status"`
+		Message      string `json:"message"`
+		Provider     string `json:"provider"`
+		Id           string `json:"id"`
+		Title        string `json:"title"`
+		Artists      string `json:"artists"`
+		Path         string `json:"path"`
+		Bytes        int64  `json:"bytes"`
+		DurationMs   int64  `json:"durationMs"`
+		URL          string `json:"url"`
+		FallbackFrom string `json:"fallbackFrom,omitempty"`
+	}
+)
+
+// NewReport builds the report of the download tasks.
+func NewReport(tasks []provider.DownloadTask) *Report {
+	r := &Report{
+		CreatedAt: time.Now(),
+		Total:     len(tasks),
+		Tracks:    make([]*ReportRecord, 0, len(tasks)),
+	}
+	for _, task := range tasks {
+		switch task.Status {
+		case ecode.Success:
+			r.Success++
+		case ecode.AlreadyDownloaded, ecode.DownloadedBefore:
+			r.Ignore++
+		default:
+			r.Failure++
+		}
+		r.Tracks = append(r.Tracks, newReportRecord(task))
+	}
+	return r
+}
+
+func newReportRecord(task provider.DownloadTask) *ReportRecord {
+	m := task.MP3
+	record := &ReportRecord{
+		Status:     task.Status,
+		Message:    ecode.Message(task.Status),
+		Provider:   provider.PlatformName(m.Provider),
+		Path:       task.Path,
+		Bytes:      task.Bytes,
+		DurationMs: task.Elapsed.Milliseconds(),
+		URL:        m.DownloadURL,
+	}
+	if m.Track != nil {
+		record.Id = m.Track.Id
+		record.Title = m.Track.Title
+		record.Artists = strings.Join(m.Track.Artists, ", ")
+	}
+	if m.Origin != nil {
+		record.FallbackFrom = provider.PlatformName(m.Origin.Provider)
+	}
+	return record
+}
+
+// WriteReport writes the report into the named file, as CSV with a header if the extension is ".csv",
+// otherwise as a JSON document.
+func WriteReport(name string, r *Report) error {
+	var data []byte
+	var err error
+	if strings.EqualFold(filepath.Ext(name), ReportFormatCSV) {
+		data, err = r.csv()
+	} else {
+		data, err = r.json()
+	}
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, data, 0644)
+}
+
+func (r *Report) json() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "\t")
+	if err := enc.Encode(r); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (r *Report) csv() ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(reportCSVHeader); err != nil {
+		return nil, err
+	}
+	for _, i := range r.Tracks {
+		err := w.Write([]string{
+			strconv.Itoa(i.Status), i.Message, i.Provider, i.Id, i.Title, i.Artists,
+			i.Path, strconv.FormatInt(i.Bytes, 10), strconv.FormatInt(i.DurationMs, 10), i.URL, i.FallbackFrom,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/winterssy/music-get/internal/ecode"
+	"github.com/winterssy/music-get/provider"
+)
+
+func testSong(id, title string) *provider.MP3 {
+	return &provider.MP3{
+		FileName: title + ".mp3",
+		Provider: provider.NetEaseMusic,
+		Track:    &provider.Track{Id: id, Title: title},
+	}
+}
+
+func testTasks() []provider.DownloadTask {
+	a := &provider.MP3{
+		FileName:    "a.mp3",
+		Playable:    true,
+		DownloadURL: "http://a",
+		Provider:    provider.QQMusic,
+		Track:       &provider.Track{Id: "001", Title: "a", Artists: []string{"x", "y"}},
+		Origin:      &provider.MP3{Provider: provider.NetEaseMusic},
+	}
+	b := &provider.MP3{FileName: "b.mp3", Provider: provider.KuwoMusic, Track: &provider.Track{Id: "2", Title: "b"}}
+	return []provider.DownloadTask{
+		{MP3: a, Status: ecode.Success, Path: "/music/a.mp3", Bytes: 1024, Elapsed: 1500 * time.Millisecond},
+		{MP3: b, Status: ecode.SongUnavailable, Path: "/music/b.mp3"},
+	}
+}
+
+func TestNewReport(t *testing.T) {
+	r := NewReport(testTasks())
+	if r.Total != 2 || r.Success != 1 || r.Failure != 1 || r.Ignore != 0 {
+		t.Fatalf("NewReport got summary: %d/%d/%d/%d", r.Total, r.Success, r.Failure, r.Ignore)
+	}
+
+	want := &ReportRecord{
+		Status:       ecode.Success,
+		Message:      ecode.Message(ecode.Success),
+		Provider:     "qq",
+		Id:           "001",
+		Title:        "a",
+		Artists:      "x, y",
+		Path:         "/music/a.mp3",
+		Bytes:        1024,
+		DurationMs:   1500,
+		URL:          "http://a",
+		FallbackFrom: "netease",
+	}
+	if !reflect.DeepEqual(r.Tracks[0], want) {
+		t.Errorf("NewReport got: %+v, want: %+v", r.Tracks[0], want)
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "music-get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := NewReport(testTasks())
+
+	jsonPath := filepath.Join(dir, "report.json")
+	if err = WriteReport(jsonPath, r); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := new(Report)
+	if err = json.Unmarshal(data, got); err != nil {
+		t.Fatalf("report.json is not valid JSON: %v", err)
+	}
+	if !reflect.DeepEqual(got.Tracks, r.Tracks) {
+		t.Errorf("report.json got: %+v, want: %+v", got.Tracks, r.Tracks)
+	}
+
+	csvPath := filepath.Join(dir, "report.CSV")
+	if err = WriteReport(csvPath, r); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("report.csv is not valid CSV: %v", err)
+	}
+	if len(records) != 3 || !reflect.DeepEqual(records[0], reportCSVHeader) {
+		t.Fatalf("report.csv got: %v", records)
+	}
+	if records[1][0] != "-1" || records[1][7] != "1024" || records[1][8] != "1500" || records[1][10] != "netease" {
+		t.Errorf("report.csv got record: %v", records[1])
+	}
+}
@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/winterssy/easylog"
+	"github.com/winterssy/music-get/conf"
+	"github.com/winterssy/music-get/internal/ecode"
+	"github.com/winterssy/music-get/provider"
+)
+
+type (
+	// RetryRequest re-resolves a track of a previous run from its provider,
+	// the song is saved to the same path as before.
+	RetryRequest struct {
+		provider.MusicRequest
+		Record *ReportRecord
+	}
+)
+
+// ReadReport reads the track records of a report written by WriteReport,
+// or the download errors of the log file.
+func ReadReport(name string) ([]*ReportRecord, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(filepath.Ext(name), ReportFormatCSV) {
+		return parseReportCSV(data)
+	}
+	return parseReportJSON(data)
+}
+
+func parseReportCSV(data []byte) ([]*ReportRecord, error) {
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("empty report")
+	}
+
+	columns := make(map[string]int, len(rows[0]))
+	for i, name := range rows[0] {
+		columns[name] = i
+	}
+	for _, name := range []string{"status", "provider", "id"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing report column: %q", name)
+		}
+	}
+	field := func(row []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+
+	records := make([]*ReportRecord, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		status, err := strconv.Atoi(field(row, "status"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid report status: %q", field(row, "status"))
+		}
+		size, _ := strconv.ParseInt(field(row, "bytes"), 10, 64)
+		durationMs, _ := strconv.ParseInt(field(row, "durationMs"), 10, 64)
+		records = append(records, &ReportRecord{
+			Status:       status,
+			Message:      field(row, "message"),
+			Provider:     field(row, "provider"),
+			Id:           field(row, "id"),
+			Title:        field(row, "title"),
+			Artists:      field(row, "artists"),
+			Path:         field(row, "path"),
+			Bytes:        size,
+			DurationMs:   durationMs,
+			URL:          field(row, "url"),
+			FallbackFrom: field(row, "fallbackFrom"),
+		})
+	}
+	return records, nil
+}
+
+// parseReportJSON parses a JSON report, or the stream of download errors written into the log file.
+func parseReportJSON(data []byte) ([]*ReportRecord, error) {
+	records := make([]*ReportRecord, 0)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var fields map[string]json.RawMessage
+		if err = json.Unmarshal(raw, &fields); err != nil {
+			return nil, err
+		}
+		if _, ok := fields["tracks"]; ok {
+			r := new(Report)
+			if err = json.Unmarshal(raw, r); err != nil {
+				return nil, err
+			}
+			records = append(records, r.Tracks...)
+			continue
+		}
+
+		dlErr := new(DownloadError)
+		if err = json.Unmarshal(raw, dlErr); err != nil {
+			return nil, err
+		}
+		records = append(records, &ReportRecord{
+			Status:   dlErr.Code,
+			Message:  dlErr.Reason,
+			Provider: dlErr.Source,
+			Id:       dlErr.Id,
+			Path:     dlErr.Path,
+			URL:      dlErr.URL,
+		})
+	}
+	return records, nil
+}
+
+// RetryRecords returns the failed records to retry, the unavailable songs are skipped unless force is true.
+func RetryRecords(records []*ReportRecord, force bool) []*ReportRecord {
+	retries := make([]*ReportRecord, 0, len(records))
+	for _, i := range records {
+		switch i.Status {
+		case ecode.Success, ecode.AlreadyDownloaded, ecode.DownloadedBefore:
+			continue
+		case ecode.SongUnavailable:
+			if !force {
+				easylog.Debugf("Skip unavailable song: %s", i.Path)
+				continue
+			}
+		}
+		retries = append(retries, i)
+	}
+	return retries
+}
+
+// NewRetryRequest creates the request to re-resolve the track of record from its provider.
+func NewRetryRequest(record *ReportRecord) (*RetryRequest, error) {
+	platform, ok := provider.ParsePlatform(record.Provider)
+	if !ok {
+		return nil, fmt.Errorf("unknown provider: %q", record.Provider)
+	}
+	if record.Id == "" {
+		return nil, errors.New("missing track id")
+	}
+	req, err := provider.NewSongRequest(platform, record.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &RetryRequest{MusicRequest: req, Record: record}, nil
+}
+
+// Prepare prepares the song as usual, then locates it to the path of the record,
+// except the extension which follows the format delivered this time.
+func (r *RetryRequest) Prepare(ctx context.Context) ([]*provider.MP3, error) {
+	mp3List, err := r.MusicRequest.Prepare(ctx)
+	if err != nil || r.Record.Path == "" {
+		return mp3List, err
+	}
+
+	savePath := "."
+	dir, err1 := filepath.Abs(filepath.Dir(r.Record.Path))
+	downloadDir, err2 := filepath.Abs(conf.Conf.DownloadDir)
+	if err1 == nil && err2 == nil {
+		if rel, err := filepath.Rel(downloadDir, dir); err == nil {
+			savePath = rel
+		}
+	}
+	for _, m := range mp3List {
+		ext := filepath.Ext(m.FileName)
+		m.FileName, m.SavePath = filepath.Base(r.Record.Path), savePath
+		m.SetExt(ext)
+	}
+	return mp3List, nil
+}
+
+// RetryReportFile returns the name of the fresh report of retrying the named file,
+// in the same format for a report, or JSON for the log file.
+func RetryReportFile(name string) string {
+	ext := filepath.Ext(name)
+	if !strings.EqualFold(ext, ReportFormatCSV) {
+		ext = ".json"
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name)) + ".retry" + ext
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/winterssy/music-get/internal/ecode"
+)
+
+func TestReadReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "music-get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := NewReport(testTasks())
+	for _, name := range []string{"report.json", "report.csv"} {
+		path := filepath.Join(dir, name)
+		if err = WriteReport(path, r); err != nil {
+			t.Fatal(err)
+		}
+		records, err := ReadReport(path)
+		if err != nil {
+			t.Fatalf("ReadReport %s failed: %v", name, err)
+		}
+		if !reflect.DeepEqual(records, r.Tracks) {
+			t.Errorf("ReadReport %s got: %+v, want: %+v", name, records, r.Tracks)
+		}
+	}
+
+	log := `{
+	"filename": "a.mp3",
+	"source": "qq",
+	"id": "001",
+	"path": "/music/a.mp3",
+	"code": 1001,
+	"reason": "a"
+}
+{
+	"filename": "b.mp3",
+	"url": "http://b",
+	"source": "kuwo",
+	"code": 1003,
+	"reason": "b"
+}
+`
+	path := filepath.Join(dir, LogFileName)
+	if err = ioutil.WriteFile(path, []byte(log), 0644); err != nil {
+		t.Fatal(err)
+	}
+	records, err := ReadReport(path)
+	if err != nil {
+		t.Fatalf("ReadReport log failed: %v", err)
+	}
+	want := []*ReportRecord{
+		{Status: 1001, Message: "a", Provider: "qq", Id: "001", Path: "/music/a.mp3"},
+		{Status: 1003, Message: "b", Provider: "kuwo", URL: "http://b"},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("ReadReport log got: %+v, want: %+v", records, want)
+	}
+}
+
+func TestRetryRecords(t *testing.T) {
+	records := []*ReportRecord{
+		{Status: ecode.Success},
+		{Status: ecode.AlreadyDownloaded},
+		{Status: ecode.SongUnavailable},
+		{Status: ecode.FileTransferException},
+	}
+
+	got := RetryRecords(records, false)
+	if len(got) != 1 || got[0] != records[3] {
+		t.Errorf("RetryRecords got: %+v", got)
+	}
+
+	got = RetryRecords(records, true)
+	if len(got) != 2 || got[0] != records[2] || got[1] != records[3] {
+		t.Errorf("RetryRecords with force got: %+v", got)
+	}
+}
+
+func TestRetryReportFile(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"music-get.log", "music-get.retry.json"},
+		{"report.json", "report.retry.json"},
+		{"out/report.CSV", "out/report.retry.CSV"},
+	}
+
+	for _, test := range tests {
+		if got := RetryReportFile(test.name); got != test.want {
+			t.Errorf("RetryReportFile(%q) got: %q, want: %q", test.name, got, test.want)
+		}
+	}
+}
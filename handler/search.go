@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/winterssy/easylog"
+	"github.com/winterssy/music-get/provider"
+)
+
+const (
+	titleColumnWidth  = 36
+	artistColumnWidth = 24
+	albumColumnWidth  = 24
+)
+
+type (
+	rankedResult struct {
+		*provider.SearchResult
+		score    int
+		position int
+	}
+)
+
+// Search searches songs by keyword on the platforms concurrently, and returns a single list
+// ranked by relevance. Errors of a platform are logged only.
+func Search(ctx context.Context, keyword string, platforms []int, limit int) []*provider.SearchResult {
+	lists := make([][]*provider.SearchResult, len(platforms))
+	var wg sync.WaitGroup
+	for i, platform := range platforms {
+		wg.Add(1)
+		go func(i, platform int) {
+			defer wg.Done()
+			results, err := provider.Search(ctx, platform, keyword, limit)
+			if err != nil {
+				easylog.Warnf("Search failed: %s: %s", provider.PlatformName(platform), err.Error())
+				return
+			}
+			lists[i] = results
+		}(i, platform)
+	}
+	wg.Wait()
+
+	return rank(keyword, lists...)
+}
+
+// rank merges the results of the platforms, ordered by the matching score,
+// then the position in the results of its platform, then the platform order.
+func rank(keyword string, lists ...[]*provider.SearchResult) []*provider.SearchResult {
+	ranked := make([]*rankedResult, 0)
+	for _, list := range lists {
+		for i, r := range list {
+			ranked = append(ranked, &rankedResult{SearchResult: r, score: score(keyword, r.Track), position: i})
+		}
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].score != ranked[j].score {
+			return ranked[i].score > ranked[j].score
+		}
+		return ranked[i].position < ranked[j].position
+	})
+
+	results := make([]*provider.SearchResult, 0, len(ranked))
+	for _, i := range ranked {
+		results = append(results, i.SearchResult)
+	}
+	return results
+}
+
+// score measures how well the track matches the keyword, the title weighs the most.
+func score(keyword string, t *provider.Track) int {
+	keyword = strings.ToLower(strings.TrimSpace(keyword))
+	title := strings.ToLower(t.Title)
+	artists := strings.ToLower(strings.Join(t.Artists, " "))
+	album := strings.ToLower(t.Album)
+
+	n := 0
+	switch {
+	case title == keyword:
+		n += 50
+	case strings.Contains(title, keyword):
+		n += 20
+	}
+	for _, token := range strings.Fields(keyword) {
+		switch {
+		case title == token:
+			n += 15
+		case strings.Contains(title, token):
+			n += 10
+		case strings.Contains(artists, token):
+			n += 8
+		case strings.Contains(album, token):
+			n += 3
+		}
+	}
+	return n
+}
+
+// PrintSearchResults prints the search results as a table, the index counts from 1.
+func PrintSearchResults(w io.Writer, results []*provider.SearchResult) {
+	fmt.Fprintf(w, "%4s  %s  %s  %s  %8s  %s\n", "#",
+		pad("Title", titleColumnWidth), pad("Artists", artistColumnWidth), pad("Album", albumColumnWidth),
+		"Duration", "Provider")
+	for i, r := range results {
+		fmt.Fprintf(w, "%4d  %s  %s  %s  %8s  %s\n", i+1,
+			pad(r.Track.Title, titleColumnWidth),
+			pad(strings.Join(r.Track.Artists, ", "), artistColumnWidth),
+			pad(r.Track.Album, albumColumnWidth),
+			formatDuration(r.Track.Duration),
+			provider.PlatformName(r.Provider))
+	}
+}
+
+func formatDuration(d time.Duration) string {
+	if d <= 0 {
+		return "--:--"
+	}
+	sec := int(d.Round(time.Second) / time.Second)
+	return fmt.Sprintf("%02d:%02d", sec/60, sec%60)
+}
+
+// pad truncates or pads s with spaces to the display width, wide characters take 2 columns.
+func pad(s string, width int) string {
+	if displayWidth(s) > width {
+		var sb strings.Builder
+		w := 0
+		for _, r := range s {
+			rw := runeWidth(r)
+			if w+rw > width-2 {
+				break
+			}
+			sb.WriteRune(r)
+			w += rw
+		}
+		s = sb.String() + ".."
+	}
+	return s + strings.Repeat(" ", width-displayWidth(s))
+}
+
+func displayWidth(s string) int {
+	w := 0
+	for _, r := range s {
+		w += runeWidth(r)
+	}
+	return w
+}
+
+func runeWidth(r rune) int {
+	switch {
+	case r == utf8.RuneError || unicode.Is(unicode.Mn, r):
+		return 0
+	case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hangul, r) ||
+		unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) ||
+		(r >= 0x3000 && r <= 0x303F) || (r >= 0xFF00 && r <= 0xFF60) || (r >= 0xFFE0 && r <= 0xFFE6):
+		return 2
+	default:
+		return 1
+	}
+}
+
+// ParseSelection parses the rows picked by the user, such as "1 3 5-7", "1,3" or "all",
+// and returns the 0-based indexes in order without duplicates. n is the number of rows.
+func ParseSelection(s string, n int) ([]int, error) {
+	s = strings.TrimSpace(s)
+	if strings.EqualFold(s, "all") || s == "*" {
+		indexes := make([]int, n)
+		for i := range indexes {
+			indexes[i] = i
+		}
+		return indexes, nil
+	}
+
+	picked := make(map[int]bool)
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	for _, field := range fields {
+		lo, hi := field, field
+		if i := strings.Index(field, "-"); i > 0 {
+			lo, hi = field[:i], field[i+1:]
+		}
+		from, err := strconv.Atoi(lo)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selection: %q", field)
+		}
+		to, err := strconv.Atoi(hi)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selection: %q", field)
+		}
+		if from < 1 || to > n || from > to {
+			return nil, fmt.Errorf("selection out of range: %q", field)
+		}
+		for i := from; i <= to; i++ {
+			picked[i-1] = true
+		}
+	}
+	if len(picked) == 0 {
+		return nil, errors.New("nothing selected")
+	}
+
+	indexes := make([]int, 0, len(picked))
+	for i := range picked {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	return indexes, nil
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/winterssy/music-get/provider"
+)
+
+func TestRank(t *testing.T) {
+	a := &provider.SearchResult{Track: &provider.Track{Title: "晴天 (Live)", Artists: []string{"周杰伦"}}, Provider: provider.NetEaseMusic}
+	b := &provider.SearchResult{Track: &provider.Track{Title: "晴天", Artists: []string{"Cover"}}, Provider: provider.NetEaseMusic}
+	c := &provider.SearchResult{Track: &provider.Track{Title: "晴天", Artists: []string{"周杰伦"}}, Provider: provider.QQMusic}
+	d := &provider.SearchResult{Track: &provider.Track{Title: "七里香", Artists: []string{"周杰伦"}, Album: "晴天"}, Provider: provider.QQMusic}
+
+	got := rank("周杰伦 晴天", []*provider.SearchResult{a, b}, []*provider.SearchResult{c, d})
+	want := []*provider.SearchResult{c, a, b, d}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rank got: %v, want: %v", got, want)
+	}
+}
+
+func TestParseSelection(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []int
+		err   bool
+	}{
+		{"1", []int{0}, false},
+		{"3 1,2", []int{0, 1, 2}, false},
+		{"2-4 3", []int{1, 2, 3}, false},
+		{"all", []int{0, 1, 2, 3, 4}, false},
+		{"0", nil, true},
+		{"6", nil, true},
+		{"4-2", nil, true},
+		{"a", nil, true},
+		{" , ", nil, true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseSelection(test.input, 5)
+		if (err != nil) != test.err {
+			t.Errorf("ParseSelection(%q) error: %v", test.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseSelection(%q) got: %v, want: %v", test.input, got, test.want)
+		}
+	}
+}
+
+func TestPad(t *testing.T) {
+	tests := []struct {
+		input string
+		width int
+		want  string
+	}{
+		{"abc", 5, "abc  "},
+		{"晴天", 6, "晴天  "},
+		{"abcdefg", 5, "abc.."},
+		{"一路向北", 7, "一路.. "},
+	}
+
+	for _, test := range tests {
+		if got := pad(test.input, test.width); got != test.want {
+			t.Errorf("pad(%q, %d) got: %q, want: %q", test.input, test.width, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/winterssy/easylog"
+	"github.com/winterssy/music-get/internal/ecode"
+	"github.com/winterssy/music-get/provider"
+	"github.com/winterssy/music-get/utils"
+)
+
+const (
+	// SyncManifestName is the file name of the manifest in the playlist directory
+	SyncManifestName = ".music-get-sync.json"
+	// SyncRemovedDir is the directory in the playlist directory which the removed songs are moved into
+	SyncRemovedDir = ".removed"
+)
+
+// What to do with the songs removed from the playlist.
+const (
+	SyncKeep   = "keep"
+	SyncMove   = "move"
+	SyncDelete = "delete"
+)
+
+type (
+	// SyncManifest records the songs of a synced playlist by provider song id,
+	// so that the songs on disk are never downloaded again even if renamed.
+	SyncManifest struct {
+		Title     string                `json:"title"`
+		URL       string                `json:"url"`
+		UpdatedAt time.Time             `json:"updatedAt"`
+		Songs     map[string]*SyncEntry `json:"songs"`
+	}
+
+	// SyncEntry is a song of the playlist on disk.
+	SyncEntry struct {
+		// Path is relative to the playlist directory, slash separated
+		Path    string    `json:"path"`
+		Title   string    `json:"title,omitempty"`
+		AddedAt time.Time `json:"addedAt"`
+	}
+
+	// SyncPlan is the difference between the playlist and the manifest.
+	SyncPlan struct {
+		// Download are the songs new to the playlist, or missing on disk
+		Download []*provider.MP3
+		// Kept are the songs on disk, as already downloaded tasks
+		Kept []provider.DownloadTask
+		// Removed are the songs no longer in the playlist, keyed by the song key
+		Removed map[string]*SyncEntry
+	}
+)
+
+// LoadSyncManifest reads the manifest in the playlist directory, an empty one if it doesn't exist.
+func LoadSyncManifest(dir string) (*SyncManifest, error) {
+	s := &SyncManifest{Songs: make(map[string]*SyncEntry)}
+	data, err := ioutil.ReadFile(filepath.Join(dir, SyncManifestName))
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	if s.Songs == nil {
+		s.Songs = make(map[string]*SyncEntry)
+	}
+	return s, nil
+}
+
+// Save writes the manifest into the playlist directory.
+func (s *SyncManifest) Save(dir string) error {
+	data, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err = utils.BuildPathIfNotExist(dir); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, SyncManifestName), data, 0644)
+}
+
+// Plan compares the prepared songs of the playlist with the manifest, the songs without
+// an id are always downloaded, which are skipped as usual if their files exist.
+func (s *SyncManifest) Plan(dir string, mp3List []*provider.MP3) *SyncPlan {
+	plan := &SyncPlan{
+		Download: make([]*provider.MP3, 0),
+		Kept:     make([]provider.DownloadTask, 0),
+		Removed:  make(map[string]*SyncEntry),
+	}
+	current := make(map[string]bool, len(mp3List))
+	for _, m := range mp3List {
+		key := m.Key()
+		if key == "" {
+			plan.Download = append(plan.Download, m)
+			continue
+		}
+		current[key] = true
+
+		if e, ok := s.Songs[key]; ok {
+			fPath := filepath.Join(dir, filepath.FromSlash(e.Path))
+			if exists, _ := utils.ExistsPath(fPath); exists {
+				plan.Kept = append(plan.Kept, provider.DownloadTask{MP3: m, Status: ecode.AlreadyDownloaded, Path: fPath})
+				continue
+			}
+		}
+		plan.Download = append(plan.Download, m)
+	}
+
+	for key, e := range s.Songs {
+		if !current[key] {
+			plan.Removed[key] = e
+		}
+	}
+	return plan
+}
+
+// Update records the songs on disk after the download, a fallback is recorded by the song it replaces.
+func (s *SyncManifest) Update(dir string, tasks []provider.DownloadTask) {
+	now := time.Now()
+	for _, task := range tasks {
+		if task.Status != ecode.Success && task.Status != ecode.AlreadyDownloaded {
+			continue
+		}
+		m := task.MP3
+		for m.Origin != nil {
+			m = m.Origin
+		}
+		key := m.Key()
+		if key == "" {
+			continue
+		}
+		rel, err := filepath.Rel(dir, task.Path)
+		if err != nil {
+			continue
+		}
+
+		e, ok := s.Songs[key]
+		if !ok {
+			e = &SyncEntry{AddedAt: now}
+			s.Songs[key] = e
+		}
+		e.Path, e.Title = filepath.ToSlash(rel), m.Track.Title
+	}
+	s.UpdatedAt = now
+}
+
+// Remove keeps, moves into SyncRemovedDir or deletes the removed songs and their lyrics as mode,
+// then drops them from the manifest. It returns the paths handled in order, the songs failed
+// to handle are kept in the manifest. The songs out of dir are always kept on disk.
+func (s *SyncManifest) Remove(dir string, removed map[string]*SyncEntry, mode string) ([]string, error) {
+	keys := make([]string, 0, len(removed))
+	for key := range removed {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	paths := make([]string, 0, len(keys))
+	var errs []string
+	for _, key := range keys {
+		e := removed[key]
+		// the songs saved out of the playlist directory belong to other albums or playlists as well
+		if mode != SyncKeep && !inDir(e.Path) {
+			easylog.Warnf("Keep the song out of the playlist directory: %s", e.Path)
+			delete(s.Songs, key)
+			continue
+		}
+		fPath := filepath.Join(dir, filepath.FromSlash(e.Path))
+		files := []string{fPath, strings.TrimSuffix(fPath, filepath.Ext(fPath)) + ".lrc"}
+
+		var err error
+		switch mode {
+		case SyncKeep:
+		case SyncMove:
+			err = moveFiles(files, filepath.Join(dir, SyncRemovedDir))
+		case SyncDelete:
+			err = removeFiles(files)
+		default:
+			return paths, fmt.Errorf("unknown removal mode: %q", mode)
+		}
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		delete(s.Songs, key)
+		paths = append(paths, e.Path)
+	}
+
+	if len(errs) > 0 {
+		return paths, fmt.Errorf("remove songs failed: %s", strings.Join(errs, "; "))
+	}
+	return paths, nil
+}
+
+// inDir reports whether the slash separated relative path stays inside its base directory.
+func inDir(rel string) bool {
+	rel = filepath.Clean(filepath.FromSlash(rel))
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// moveFiles moves the existing files into dir, numbered as "name (2).ext" if the name is taken.
+func moveFiles(files []string, dir string) error {
+	if err := utils.BuildPathIfNotExist(dir); err != nil {
+		return err
+	}
+	for _, i := range files {
+		if exists, _ := utils.ExistsPath(i); !exists {
+			continue
+		}
+
+		name := filepath.Base(i)
+		ext := filepath.Ext(name)
+		target := filepath.Join(dir, name)
+		for n := 2; ; n++ {
+			if exists, _ := utils.ExistsPath(target); !exists {
+				break
+			}
+			target = filepath.Join(dir, fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext))
+		}
+		if err := os.Rename(i, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeFiles(files []string) error {
+	for _, i := range files {
+		if err := os.Remove(i); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/winterssy/music-get/internal/ecode"
+	"github.com/winterssy/music-get/provider"
+	"github.com/winterssy/music-get/utils"
+)
+
+func TestSyncManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "music-get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name string) string {
+		fPath := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(fPath, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return fPath
+	}
+
+	// the first run, a is downloaded, b failed, c is replaced by a fallback, e is downloaded before but moved
+	s, err := LoadSyncManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b, c, e := testSong("1", "a"), testSong("2", "b"), testSong("3", "c"), testSong("5", "e")
+	plan := s.Plan(dir, []*provider.MP3{a, b, c, e})
+	if len(plan.Download) != 4 || len(plan.Kept) != 0 || len(plan.Removed) != 0 {
+		t.Fatalf("Plan of the first run got %d/%d/%d", len(plan.Download), len(plan.Kept), len(plan.Removed))
+	}
+	alt := &provider.MP3{Provider: provider.QQMusic, Track: &provider.Track{Id: "003", Title: "c"}, Origin: c}
+	s.Update(dir, []provider.DownloadTask{
+		{MP3: a, Status: ecode.Success, Path: write("a.mp3")},
+		{MP3: b, Status: ecode.HTTPRequestException, Path: filepath.Join(dir, "b.mp3")},
+		{MP3: alt, Status: ecode.Success, Path: write("c.flac")},
+		{MP3: e, Status: ecode.DownloadedBefore, Path: filepath.Join(dir, "e.mp3")},
+	})
+	write("a.lrc")
+	if err = s.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// the second run, a is renamed and removed from the playlist, b is retried, c is kept, d is new
+	if s, err = LoadSyncManifest(dir); err != nil {
+		t.Fatal(err)
+	}
+	if got := []string{s.Songs["0:1"].Path, s.Songs["0:3"].Path}; !reflect.DeepEqual(got, []string{"a.mp3", "c.flac"}) {
+		t.Errorf("LoadSyncManifest got paths %v", got)
+	}
+	if _, ok := s.Songs["0:5"]; ok {
+		t.Error("Update should not record the song moved out of band")
+	}
+	b, c, d := testSong("2", "b"), testSong("3", "c renamed"), testSong("4", "d")
+	plan = s.Plan(dir, []*provider.MP3{b, c, d})
+	if len(plan.Download) != 2 || plan.Download[0] != b || plan.Download[1] != d {
+		t.Errorf("Plan got downloads %v", plan.Download)
+	}
+	if len(plan.Kept) != 1 || plan.Kept[0].MP3 != c || plan.Kept[0].Path != filepath.Join(dir, "c.flac") {
+		t.Errorf("Plan got kept %v", plan.Kept)
+	}
+	if len(plan.Removed) != 1 || plan.Removed["0:1"] == nil {
+		t.Errorf("Plan got removed %v", plan.Removed)
+	}
+
+	paths, err := s.Remove(dir, plan.Removed, SyncMove)
+	if err != nil || !reflect.DeepEqual(paths, []string{"a.mp3"}) {
+		t.Fatalf("Remove got %v, %v", paths, err)
+	}
+	for name, want := range map[string]bool{
+		"a.mp3":                                false,
+		"a.lrc":                                false,
+		filepath.Join(SyncRemovedDir, "a.mp3"): true,
+		filepath.Join(SyncRemovedDir, "a.lrc"): true,
+	} {
+		if exists, _ := utils.ExistsPath(filepath.Join(dir, name)); exists != want {
+			t.Errorf("Remove got %s exists: %v", name, exists)
+		}
+	}
+	if _, ok := s.Songs["0:1"]; ok {
+		t.Error("Remove should drop the song from the manifest")
+	}
+}
+
+func TestSyncManifest_Remove(t *testing.T) {
+	dir, err := ioutil.TempDir("", "music-get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the name is taken in the removed directory
+	for _, name := range []string{"a.mp3", filepath.Join(SyncRemovedDir, "a.mp3")} {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+		if err = ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := &SyncManifest{Songs: map[string]*SyncEntry{
+		"0:1": {Path: "a.mp3"},
+		"0:2": {Path: "missing.mp3"},
+	}}
+	if _, err = s.Remove(dir, map[string]*SyncEntry{"0:1": s.Songs["0:1"]}, SyncMove); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := utils.ExistsPath(filepath.Join(dir, SyncRemovedDir, "a (2).mp3")); !exists {
+		t.Error("Remove should number the moved file if the name is taken")
+	}
+
+	if _, err = s.Remove(dir, map[string]*SyncEntry{"0:2": s.Songs["0:2"]}, SyncDelete); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Songs) != 0 {
+		t.Errorf("Remove got songs %v", s.Songs)
+	}
+}
+
+func TestSyncManifest_RemoveOutOfDir(t *testing.T) {
+	root, err := ioutil.TempDir("", "music-get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// b is saved into another album by the output template, or merged into another request
+	dir := filepath.Join(root, "list")
+	for _, name := range []string{filepath.Join("list", "a.mp3"), filepath.Join("album", "b.mp3"), "c.mp3"} {
+		os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0755)
+		if err = ioutil.WriteFile(filepath.Join(root, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := &SyncManifest{Songs: map[string]*SyncEntry{
+		"0:1": {Path: "a.mp3"},
+		"0:2": {Path: "../album/b.mp3"},
+		"0:3": {Path: "sub/../../c.mp3"},
+	}}
+	removed := make(map[string]*SyncEntry, len(s.Songs))
+	for k, v := range s.Songs {
+		removed[k] = v
+	}
+	paths, err := s.Remove(dir, removed, SyncDelete)
+	if err != nil || !reflect.DeepEqual(paths, []string{"a.mp3"}) {
+		t.Fatalf("Remove got %v, %v", paths, err)
+	}
+	for name, want := range map[string]bool{
+		filepath.Join("list", "a.mp3"):  false,
+		filepath.Join("album", "b.mp3"): true,
+		"c.mp3":                         true,
+	} {
+		if exists, _ := utils.ExistsPath(filepath.Join(root, name)); exists != want {
+			t.Errorf("Remove got %s exists: %v", name, exists)
+		}
+	}
+	if len(s.Songs) != 0 {
+		t.Errorf("Remove got songs %v", s.Songs)
+	}
+}
+
+func TestInDir(t *testing.T) {
+	tests := map[string]bool{
+		"a.mp3":           true,
+		"sub/a.mp3":       true,
+		"sub/../a.mp3":    true,
+		"..a.mp3":         true,
+		"..":              false,
+		"../a.mp3":        false,
+		"sub/../../a.mp3": false,
+	}
+	for rel, want := range tests {
+		if got := inDir(rel); got != want {
+			t.Errorf("inDir(%q) = %v, want %v", rel, got, want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/winterssy/easylog"
+	"github.com/winterssy/music-get/conf"
+	"github.com/winterssy/music-get/handler"
+	"github.com/winterssy/music-get/pkg/history"
+)
+
+// manageHistory runs "music-get history list|prune|export", which manages the download history
+// in the workspace regardless of the -history option.
+func manageHistory(args []string) {
+	if len(args) == 0 {
+		easylog.Fatal("Missing history command, list, prune or export")
+	}
+
+	store, err := history.Open(filepath.Join(conf.Conf.Workspace, handler.HistoryFileName))
+	if err != nil {
+		easylog.Fatalf("Load download history failed: %s", err.Error())
+	}
+
+	switch args[0] {
+	case "list":
+		handler.PrintHistory(os.Stdout, store.Records())
+	case "prune":
+		pruneHistory(store, args[1:])
+	case "export":
+		exportHistory(store, args[1:])
+	default:
+		easylog.Fatalf("Unknown history command: %s", args[0])
+	}
+}
+
+// pruneHistory runs "history prune [-missing] [-older-than duration]".
+func pruneHistory(store *history.Store, args []string) {
+	fs := flag.NewFlagSet(HistoryCommand+" prune", flag.ExitOnError)
+	missing := fs.Bool("missing", true, "remove the records whose files no longer exist")
+	olderThan := fs.Duration("older-than", 0, "remove the records older than the duration, such as 720h")
+	if err := fs.Parse(args); err != nil {
+		easylog.Fatal(err)
+	}
+	if *olderThan < 0 {
+		easylog.Fatal("Invalid older-than parameter")
+	}
+
+	var before time.Time
+	if *olderThan > 0 {
+		before = time.Now().Add(-*olderThan)
+	}
+	removed, err := store.Prune(handler.HistoryPruneFunc(*missing, before))
+	if err != nil {
+		easylog.Fatalf("Prune download history failed: %s", err.Error())
+	}
+	for _, r := range removed {
+		easylog.Infof("Pruned: %s:%s %s", r.Provider, r.Id, r.Path)
+	}
+	easylog.Infof("Prune download history --> removed: %d, kept: %d", len(removed), len(store.Records()))
+}
+
+// exportHistory runs "history export [file]", CSV if the file name ends with .csv,
+// otherwise JSON, to stdout by default.
+func exportHistory(store *history.Store, args []string) {
+	if len(args) > 1 {
+		easylog.Fatal("Too many export files")
+	}
+	if len(args) == 0 {
+		if err := handler.ExportHistory(os.Stdout, store.Records(), ""); err != nil {
+			easylog.Fatal(err)
+		}
+		return
+	}
+
+	f, err := os.Create(args[0])
+	if err != nil {
+		easylog.Fatalf("Export download history failed: %s", err.Error())
+	}
+	err = handler.ExportHistory(f, store.Records(), filepath.Ext(args[0]))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		easylog.Fatalf("Export download history failed: %s", err.Error())
+	}
+	easylog.Infof("Download history exported to %q", args[0])
+}
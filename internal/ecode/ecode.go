@@ -12,6 +12,9 @@ const (
 	APIResponseException
 	BuildFileException
 	FileTransferException
+	DownloadCanceled
+	AudioVerifyException
+	DownloadedBefore
 )
 
 func init() {
@@ -26,6 +29,9 @@ func init() {
 	errors[APIResponseException] = "api response exception"
 	errors[BuildFileException] = "build file exception"
 	errors[FileTransferException] = "file transfer exception"
+	errors[DownloadCanceled] = "download canceled"
+	errors[AudioVerifyException] = "audio verify exception"
+	errors[DownloadedBefore] = "downloaded before, file moved"
 }
 
 func Message(code int) string {
@@ -1,11 +1,26 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 
 	"github.com/winterssy/easylog"
 	"github.com/winterssy/music-get/conf"
 	"github.com/winterssy/music-get/handler"
+	"github.com/winterssy/music-get/pkg/history"
+	"github.com/winterssy/music-get/pkg/pathtemplate"
+	"github.com/winterssy/music-get/provider"
+)
+
+const (
+	SearchCommand  = "search"
+	RetryCommand   = "retry"
+	SyncCommand    = "sync"
+	HistoryCommand = "history"
 )
 
 func main() {
@@ -15,47 +30,169 @@ func main() {
 		easylog.Fatal(err)
 	}
 
-	if len(flag.Args()) == 0 {
-		easylog.Fatal("Missing music address")
+	args := flag.Args()
+	if len(args) > 0 && args[0] == HistoryCommand {
+		manageHistory(args[1:])
+		return
+	}
+
+	if conf.Conf.History {
+		loadHistory()
+	}
+	ctx := interruptContext()
+	switch {
+	case len(args) > 0 && args[0] == SearchCommand:
+		search(ctx, args[1:])
+	case len(args) > 0 && args[0] == RetryCommand:
+		retry(ctx, args[1:])
+	case len(args) > 0 && args[0] == SyncCommand:
+		syncPlaylist(ctx, args[1:])
+	default:
+		download(ctx, args)
 	}
+}
 
-	url := flag.Args()[0]
-	easylog.Debug("Parse music address")
-	req, err := handler.Parse(url)
+// loadHistory makes the downloads consult and record the download history in the workspace.
+func loadHistory() {
+	store, err := history.Open(filepath.Join(conf.Conf.Workspace, handler.HistoryFileName))
 	if err != nil {
-		easylog.Fatal(err)
+		easylog.Warnf("Load download history failed: %s", err.Error())
+		return
 	}
+	provider.UseHistory(store)
+}
+
+// interruptContext returns a context canceled on the first interrupt, so that no more songs
+// are requested or downloaded, the downloading ones are aborted cleanly and the report is still printed.
+// The second interrupt exits immediately.
+func interruptContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ch
+		easylog.Warn("Interrupted, stop downloading, press Ctrl+C again to exit immediately")
+		cancel()
+		<-ch
+		os.Exit(130)
+	}()
+	return ctx
+}
 
-	if req.RequireLogin() {
-		easylog.Info("Unauthorized, please login")
-		if err = req.Login(); err != nil {
-			easylog.Fatalf("Login failed: %s", err.Error())
+func download(ctx context.Context, urls []string) {
+	if conf.Conf.InputFile != "" {
+		easylog.Debugf("Read music addresses from %q", conf.Conf.InputFile)
+		batch, err := handler.ReadAddressFile(conf.Conf.InputFile)
+		if err != nil {
+			easylog.Fatalf("Read input file failed: %s", err.Error())
 		}
-		easylog.Info("Login successful")
+		urls = append(urls, batch...)
 	}
 
-	if err := conf.Conf.Save(); err != nil {
-		easylog.Errorf("Save config failed: %s", err.Error())
+	if len(urls) == 0 {
+		easylog.Fatal("Missing music address")
 	}
 
-	if err = req.Do(); err != nil {
-		easylog.Fatal(err)
+	reqs := make([]provider.MusicRequest, 0, len(urls))
+	for _, url := range urls {
+		easylog.Debugf("Parse music address: %s", url)
+		req, err := handler.Parse(url)
+		if err != nil {
+			easylog.Errorf("Parse music address failed: %s: %s", url, err.Error())
+			continue
+		}
+		reqs = append(reqs, req)
 	}
 
-	mp3List, err := req.Prepare()
-	if err != nil {
-		easylog.Fatal(err)
+	run(ctx, reqs)
+}
+
+// run requests the music, then downloads them in one queue.
+func run(ctx context.Context, reqs []provider.MusicRequest) {
+	tmpl := outputTemplate()
+	login(reqs)
+
+	lists := make([][]*provider.MP3, 0, len(reqs))
+	playlists := make([]*handler.Playlist, 0)
+	for _, req := range reqs {
+		if ctx.Err() != nil {
+			break
+		}
+
+		if err := req.Do(ctx); err != nil {
+			easylog.Error(err)
+			continue
+		}
+
+		mp3List, err := req.Prepare(ctx)
+		if err != nil {
+			easylog.Error(err)
+			continue
+		}
+		lists = append(lists, mp3List)
+		if c, ok := req.(provider.Collection); ok && len(mp3List) > 0 {
+			playlists = append(playlists, handler.NewPlaylist(c.CollectionName(), mp3List))
+		}
+	}
+
+	mp3List := handler.MergeMP3List(lists...)
+	resolve(ctx, mp3List, tmpl)
+
+	if conf.Conf.DryRun {
+		if err := handler.PrintMP3List(os.Stdout, mp3List, conf.Conf.JSONOutput); err != nil {
+			easylog.Error(err)
+		}
+		return
 	}
 
 	if len(mp3List) == 0 {
 		return
 	}
 
-	n := conf.Conf.ConcurrentDownloadTasksCount
-	switch {
-	case n > 1:
-		handler.ConcurrentDownload(mp3List, n)
-	default:
-		handler.SingleDownload(mp3List)
+	tasks := handler.Download(ctx, mp3List, conf.Conf.ConcurrentDownloadTasksCount)
+	handler.SavePlaylists(playlists, tasks, conf.Conf.PlaylistFormats)
+}
+
+// outputTemplate parses the -o template, nil if it's not set.
+func outputTemplate() *pathtemplate.Template {
+	if conf.Conf.OutputTemplate == "" {
+		return nil
+	}
+	tmpl, err := handler.ParseOutputTemplate(conf.Conf.OutputTemplate)
+	if err != nil {
+		easylog.Fatal(err)
+	}
+	return tmpl
+}
+
+// login logs in the platforms of the requests if required, then saves the config.
+func login(reqs []provider.MusicRequest) {
+	for _, req := range reqs {
+		if req.RequireLogin() {
+			easylog.Info("Unauthorized, please login")
+			if err := req.Login(); err != nil {
+				easylog.Fatalf("Login failed: %s", err.Error())
+			}
+			easylog.Info("Login successful")
+		}
+	}
+
+	if err := conf.Conf.Save(); err != nil {
+		easylog.Errorf("Save config failed: %s", err.Error())
+	}
+}
+
+// resolve names the prepared songs by the template if any, then replaces the unavailable ones
+// with the fallbacks if required.
+func resolve(ctx context.Context, mp3List []*provider.MP3, tmpl *pathtemplate.Template) {
+	if tmpl != nil {
+		handler.ApplyTemplate(mp3List, tmpl)
+	}
+	if len(conf.Conf.Fallback) > 0 {
+		platforms, err := handler.ParsePlatforms(conf.Conf.Fallback)
+		if err != nil {
+			easylog.Fatal(err)
+		}
+		handler.Fallback(ctx, mp3List, platforms)
 	}
 }
@@ -0,0 +1,485 @@
+// Package audio sniffs the container of an audio file from its magic bytes,
+// and walks its structure to verify it's complete and estimate the duration.
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	FormatMP3  = "mp3"
+	FormatFLAC = "flac"
+	FormatM4A  = "m4a"
+	FormatAPE  = "ape"
+
+	// the max bytes skipped to find the next mp3 frame
+	maxResync = 64 << 10
+	id3v1Size = 128
+)
+
+var (
+	// ErrUnknownFormat is returned if the file isn't a supported audio, such as an HTML error page
+	ErrUnknownFormat = errors.New("unknown audio format")
+	// ErrTruncated is returned if the file ends in the middle of its structure
+	ErrTruncated = errors.New("truncated audio")
+	// ErrCorrupted is returned if the structure of the file is invalid
+	ErrCorrupted = errors.New("corrupted audio")
+
+	mp3BitRates = [4][4][16]int{
+		// MPEG 2.5
+		{
+			{},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		},
+		{},
+		// MPEG 2
+		{
+			{},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		},
+		// MPEG 1
+		{
+			{},
+			{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+			{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		},
+	}
+	mp3SampleRates = [4][3]int{
+		{11025, 12000, 8000},
+		{},
+		{22050, 24000, 16000},
+		{44100, 48000, 32000},
+	}
+)
+
+type (
+	// Info is the result of probing an audio file.
+	Info struct {
+		Format string
+		// Duration is 0 if unknown
+		Duration time.Duration
+	}
+
+	mp3Frame struct {
+		size       int
+		samples    int
+		sampleRate int
+		version    int
+		mono       bool
+	}
+)
+
+// ProbeFile probes the named audio file.
+func ProbeFile(name string) (*Info, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return Probe(f, fi.Size())
+}
+
+// Probe sniffs the format of the audio of size bytes read from r, then verifies it and estimates the duration.
+func Probe(r io.ReaderAt, size int64) (*Info, error) {
+	start := skipID3v2(r, size)
+	magic := make([]byte, 8)
+	if n, _ := r.ReadAt(magic, start); n < 4 {
+		return nil, ErrUnknownFormat
+	}
+
+	switch {
+	case bytes.Equal(magic[:4], []byte("fLaC")):
+		return probeFLAC(r, start, size)
+	case bytes.Equal(magic[4:], []byte("ftyp")) && start == 0:
+		return probeM4A(r, size)
+	case bytes.Equal(magic[:4], []byte("MAC ")):
+		return &Info{Format: FormatAPE}, nil
+	case parseMP3Frame(magic) != nil:
+		return probeMP3(r, start, size)
+	case start > 0:
+		// an ID3v2 tag followed by padding or junk before the first frame
+		if pos, ok := syncMP3(r, start, size); ok {
+			return probeMP3(r, pos, size)
+		}
+	}
+	return nil, ErrUnknownFormat
+}
+
+// skipID3v2 returns the offset after the ID3v2 tag, 0 if there isn't.
+func skipID3v2(r io.ReaderAt, size int64) int64 {
+	header := make([]byte, 10)
+	if n, _ := r.ReadAt(header, 0); n < len(header) || !bytes.Equal(header[:3], []byte("ID3")) {
+		return 0
+	}
+
+	tagSize := int64(header[6]&0x7F)<<21 | int64(header[7]&0x7F)<<14 | int64(header[8]&0x7F)<<7 | int64(header[9]&0x7F)
+	offset := 10 + tagSize
+	if header[5]&0x10 != 0 {
+		// footer present
+		offset += 10
+	}
+	if offset > size {
+		return size
+	}
+	return offset
+}
+
+func parseMP3Frame(header []byte) *mp3Frame {
+	if len(header) < 4 || header[0] != 0xFF || header[1]&0xE0 != 0xE0 {
+		return nil
+	}
+
+	version := int(header[1]>>3) & 3
+	layer := int(header[1]>>1) & 3
+	bitRateIndex := int(header[2] >> 4)
+	sampleRateIndex := int(header[2]>>2) & 3
+	padding := int(header[2]>>1) & 1
+	if version == 1 || layer == 0 || bitRateIndex == 0 || bitRateIndex == 15 || sampleRateIndex == 3 {
+		return nil
+	}
+
+	bitRate := mp3BitRates[version][layer][bitRateIndex] * 1000
+	sampleRate := mp3SampleRates[version][sampleRateIndex]
+	f := &mp3Frame{sampleRate: sampleRate, version: version, mono: header[3]>>6 == 3}
+	switch {
+	case layer == 3:
+		// layer I
+		f.samples = 384
+		f.size = (12*bitRate/sampleRate + padding) * 4
+	case layer == 2 || version == 3:
+		// layer II, or layer III of MPEG 1
+		f.samples = 1152
+		f.size = 144*bitRate/sampleRate + padding
+	default:
+		// layer III of MPEG 2 and 2.5
+		f.samples = 576
+		f.size = 72*bitRate/sampleRate + padding
+	}
+	return f
+}
+
+// syncMP3 finds the next position of two consecutive mp3 frames from pos.
+func syncMP3(r io.ReaderAt, pos, size int64) (int64, bool) {
+	buf := make([]byte, maxResync+4)
+	n, _ := r.ReadAt(buf, pos)
+	buf = buf[:n]
+	for i := 0; i+4 <= len(buf); i++ {
+		f := parseMP3Frame(buf[i:])
+		if f == nil {
+			continue
+		}
+		next := pos + int64(i+f.size)
+		header := make([]byte, 4)
+		if next == size {
+			return pos + int64(i), true
+		}
+		if n, _ := r.ReadAt(header, next); n == 4 && parseMP3Frame(header) != nil {
+			return pos + int64(i), true
+		}
+	}
+	return 0, false
+}
+
+// probeMP3 walks the frames from pos, the duration is read from the Xing or VBRI header if present,
+// otherwise it's the sum of the frames.
+func probeMP3(r io.ReaderAt, pos, size int64) (*Info, error) {
+	end := size
+	tail := make([]byte, 3)
+	if size-id3v1Size >= pos {
+		if n, _ := r.ReadAt(tail, size-id3v1Size); n == 3 && bytes.Equal(tail, []byte("TAG")) {
+			end -= id3v1Size
+		}
+	}
+
+	var frames int
+	var duration float64
+	header := make([]byte, 4)
+	for pos < end {
+		if n, _ := r.ReadAt(header, pos); n < 4 {
+			break
+		}
+		f := parseMP3Frame(header)
+		if f == nil {
+			if isTrailingTag(r, pos) {
+				break
+			}
+			next, ok := syncMP3(r, pos, end)
+			if !ok {
+				if frames == 0 {
+					return nil, ErrUnknownFormat
+				}
+				return nil, ErrCorrupted
+			}
+			pos = next
+			continue
+		}
+
+		if frames == 0 {
+			if n := vbrFrames(r, pos, f); n > 0 {
+				return mp3Info(r, pos, end, f, n)
+			}
+		}
+		if pos+int64(f.size) > end {
+			return nil, ErrTruncated
+		}
+		frames++
+		duration += float64(f.samples) / float64(f.sampleRate)
+		pos += int64(f.size)
+	}
+
+	if frames == 0 {
+		return nil, ErrUnknownFormat
+	}
+	return &Info{Format: FormatMP3, Duration: seconds(duration)}, nil
+}
+
+// mp3Info returns the info of a VBR file with the frame count from its Xing or VBRI header,
+// the frames are not walked, but the last frame is checked if it's complete.
+func mp3Info(r io.ReaderAt, pos, end int64, first *mp3Frame, frames int) (*Info, error) {
+	if err := checkLastMP3Frame(r, pos, end); err != nil {
+		return nil, err
+	}
+	duration := float64(frames) * float64(first.samples) / float64(first.sampleRate)
+	return &Info{Format: FormatMP3, Duration: seconds(duration)}, nil
+}
+
+// checkLastMP3Frame walks the frames from pos without parsing the content,
+// to verify the file is not truncated.
+func checkLastMP3Frame(r io.ReaderAt, pos, end int64) error {
+	header := make([]byte, 4)
+	for pos < end {
+		if n, _ := r.ReadAt(header, pos); n < 4 {
+			return nil
+		}
+		f := parseMP3Frame(header)
+		if f == nil {
+			if isTrailingTag(r, pos) {
+				return nil
+			}
+			next, ok := syncMP3(r, pos, end)
+			if !ok {
+				return ErrCorrupted
+			}
+			pos = next
+			continue
+		}
+		if pos+int64(f.size) > end {
+			return ErrTruncated
+		}
+		pos += int64(f.size)
+	}
+	return nil
+}
+
+// vbrFrames returns the frame count in the Xing/Info or VBRI header of the first frame, 0 if not found.
+func vbrFrames(r io.ReaderAt, pos int64, f *mp3Frame) int {
+	// the Xing header follows the side information
+	sideInfo := 32
+	switch {
+	case f.version == 3 && f.mono:
+		sideInfo = 17
+	case f.version != 3 && f.mono:
+		sideInfo = 9
+	case f.version != 3:
+		sideInfo = 17
+	}
+
+	buf := make([]byte, 12)
+	if n, _ := r.ReadAt(buf, pos+4+int64(sideInfo)); n == len(buf) {
+		tag := string(buf[:4])
+		if (tag == "Xing" || tag == "Info") && buf[7]&1 != 0 {
+			return int(binary.BigEndian.Uint32(buf[8:]))
+		}
+	}
+
+	buf = make([]byte, 18)
+	if n, _ := r.ReadAt(buf, pos+36); n == len(buf) && string(buf[:4]) == "VBRI" {
+		return int(binary.BigEndian.Uint32(buf[14:]))
+	}
+	return 0
+}
+
+func isTrailingTag(r io.ReaderAt, pos int64) bool {
+	buf := make([]byte, 8)
+	n, _ := r.ReadAt(buf, pos)
+	return n == len(buf) && (bytes.Equal(buf, []byte("APETAGEX")) || bytes.HasPrefix(buf, []byte("LYRICS")) ||
+		bytes.HasPrefix(buf, []byte("TAG")))
+}
+
+// probeFLAC walks the metadata blocks, the duration is read from STREAMINFO.
+func probeFLAC(r io.ReaderAt, start, size int64) (*Info, error) {
+	var (
+		minBlock, maxBlock int
+		minFrame           int64
+		sampleRate         int
+		totalSamples       int64
+		streamInfo         bool
+	)
+
+	pos := start + 4
+	header := make([]byte, 4)
+	for {
+		if n, _ := r.ReadAt(header, pos); n < 4 {
+			return nil, ErrTruncated
+		}
+		last := header[0]&0x80 != 0
+		blockType := header[0] & 0x7F
+		length := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		pos += 4
+		if pos+length > size {
+			return nil, ErrTruncated
+		}
+
+		if blockType == 0 {
+			if length < 34 {
+				return nil, ErrCorrupted
+			}
+			buf := make([]byte, 18)
+			if _, err := r.ReadAt(buf, pos); err != nil {
+				return nil, ErrTruncated
+			}
+			minBlock = int(binary.BigEndian.Uint16(buf))
+			maxBlock = int(binary.BigEndian.Uint16(buf[2:]))
+			minFrame = int64(buf[4])<<16 | int64(buf[5])<<8 | int64(buf[6])
+			sampleRate = int(buf[10])<<12 | int(buf[11])<<4 | int(buf[12]>>4)
+			totalSamples = int64(buf[13]&0x0F)<<32 | int64(binary.BigEndian.Uint32(buf[14:]))
+			streamInfo = true
+		}
+		pos += length
+		if last {
+			break
+		}
+	}
+	if !streamInfo || sampleRate == 0 {
+		return nil, ErrCorrupted
+	}
+
+	sync := make([]byte, 2)
+	if n, _ := r.ReadAt(sync, pos); n < 2 {
+		return nil, ErrTruncated
+	}
+	if sync[0] != 0xFF || sync[1]&0xFE != 0xF8 {
+		return nil, ErrCorrupted
+	}
+
+	// with a fixed block size, every frame but the last is at least minFrame bytes
+	if minBlock == maxBlock && maxBlock > 0 && minFrame > 0 && totalSamples > 0 {
+		frames := (totalSamples + int64(maxBlock) - 1) / int64(maxBlock)
+		if size-pos < (frames-1)*minFrame {
+			return nil, ErrTruncated
+		}
+	}
+
+	info := &Info{Format: FormatFLAC}
+	if totalSamples > 0 {
+		info.Duration = seconds(float64(totalSamples) / float64(sampleRate))
+	}
+	return info, nil
+}
+
+// probeM4A walks the top level boxes, the duration is read from moov.mvhd.
+func probeM4A(r io.ReaderAt, size int64) (*Info, error) {
+	var pos int64
+	var moov, mdat bool
+	info := &Info{Format: FormatM4A}
+	header := make([]byte, 16)
+	for pos < size {
+		if n, _ := r.ReadAt(header[:8], pos); n < 8 {
+			return nil, ErrTruncated
+		}
+		boxSize := int64(binary.BigEndian.Uint32(header))
+		boxType := string(header[4:8])
+		headerSize := int64(8)
+		switch boxSize {
+		case 0:
+			boxSize = size - pos
+		case 1:
+			if n, _ := r.ReadAt(header[8:], pos+8); n < 8 {
+				return nil, ErrTruncated
+			}
+			boxSize = int64(binary.BigEndian.Uint64(header[8:]))
+			headerSize = 16
+		}
+		if boxSize < headerSize {
+			return nil, ErrCorrupted
+		}
+		if pos+boxSize > size {
+			return nil, ErrTruncated
+		}
+
+		switch boxType {
+		case "moov":
+			moov = true
+			d, err := mvhdDuration(r, pos+headerSize, pos+boxSize)
+			if err != nil {
+				return nil, err
+			}
+			info.Duration = d
+		case "mdat":
+			mdat = true
+		}
+		pos += boxSize
+	}
+
+	if !moov || !mdat {
+		return nil, ErrTruncated
+	}
+	return info, nil
+}
+
+func mvhdDuration(r io.ReaderAt, pos, end int64) (time.Duration, error) {
+	header := make([]byte, 8)
+	for pos+8 <= end {
+		if _, err := r.ReadAt(header, pos); err != nil {
+			return 0, ErrTruncated
+		}
+		boxSize := int64(binary.BigEndian.Uint32(header))
+		if boxSize < 8 || pos+boxSize > end {
+			return 0, ErrCorrupted
+		}
+		if string(header[4:]) != "mvhd" {
+			pos += boxSize
+			continue
+		}
+
+		buf := make([]byte, boxSize-8)
+		if _, err := r.ReadAt(buf, pos+8); err != nil {
+			return 0, ErrTruncated
+		}
+		var timescale, duration uint64
+		switch {
+		case len(buf) >= 32 && buf[0] == 1:
+			timescale = uint64(binary.BigEndian.Uint32(buf[20:]))
+			duration = binary.BigEndian.Uint64(buf[24:])
+		case len(buf) >= 20:
+			timescale = uint64(binary.BigEndian.Uint32(buf[12:]))
+			duration = uint64(binary.BigEndian.Uint32(buf[16:]))
+		default:
+			return 0, ErrCorrupted
+		}
+		if timescale == 0 {
+			return 0, nil
+		}
+		return seconds(float64(duration) / float64(timescale)), nil
+	}
+	return 0, nil
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,100 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// mp3Frames returns n frames of MPEG 1 Layer III, 128kbps, 44100Hz, 417 bytes each.
+func mp3Frames(n int) []byte {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xFF, 0xFB, 0x90, 0x00})
+	return bytes.Repeat(frame, n)
+}
+
+func flacFile(audioSize int) []byte {
+	streamInfo := make([]byte, 34)
+	binary.BigEndian.PutUint16(streamInfo, 4096)
+	binary.BigEndian.PutUint16(streamInfo[2:], 4096)
+	copy(streamInfo[4:], []byte{0, 0, 10})
+	// 44100Hz, 2 channels, 16 bits, 441000 samples
+	binary.BigEndian.PutUint64(streamInfo[10:], 44100<<44|1<<41|15<<36|441000)
+
+	var buf bytes.Buffer
+	buf.WriteString("fLaC")
+	buf.Write([]byte{0x80, 0, 0, 34})
+	buf.Write(streamInfo)
+	audio := make([]byte, audioSize)
+	copy(audio, []byte{0xFF, 0xF8})
+	buf.Write(audio)
+	return buf.Bytes()
+}
+
+func box(typ string, payload []byte) []byte {
+	b := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(b, uint32(8+len(payload)))
+	copy(b[4:], typ)
+	return append(b, payload...)
+}
+
+func m4aFile(withMoov bool) []byte {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:], 180000)
+
+	var buf bytes.Buffer
+	buf.Write(box("ftyp", []byte("M4A \x00\x00\x00\x00")))
+	if withMoov {
+		buf.Write(box("moov", box("mvhd", mvhd)))
+	}
+	buf.Write(box("mdat", make([]byte, 100)))
+	return buf.Bytes()
+}
+
+func TestProbe(t *testing.T) {
+	id3v2 := append([]byte("ID3\x03\x00\x00\x00\x00\x00\x0A"), make([]byte, 10)...)
+	id3v1 := append([]byte("TAG"), make([]byte, 125)...)
+	mp3 := append(append(append([]byte{}, id3v2...), mp3Frames(100)...), id3v1...)
+
+	xing := mp3Frames(10)
+	copy(xing[36:], []byte("Xing\x00\x00\x00\x01"))
+	binary.BigEndian.PutUint32(xing[44:], 1000)
+
+	m4a := m4aFile(true)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		format   string
+		duration time.Duration
+		err      error
+	}{
+		{"mp3", mp3, FormatMP3, 2612 * time.Millisecond, nil},
+		{"mp3 truncated", mp3Frames(100)[:417*100-100], "", 0, ErrTruncated},
+		{"mp3 with xing", xing, FormatMP3, 26122 * time.Millisecond, nil},
+		{"flac", flacFile(1100), FormatFLAC, 10 * time.Second, nil},
+		{"flac truncated", flacFile(500), "", 0, ErrTruncated},
+		{"m4a", m4a, FormatM4A, 180 * time.Second, nil},
+		{"m4a truncated", m4a[:len(m4a)-10], "", 0, ErrTruncated},
+		{"m4a without moov", m4aFile(false), "", 0, ErrTruncated},
+		{"ape", []byte("MAC \x96\x0f\x00\x00"), FormatAPE, 0, nil},
+		{"html", []byte("<!DOCTYPE html><html><body>403 Forbidden</body></html>"), "", 0, ErrUnknownFormat},
+		{"empty", nil, "", 0, ErrUnknownFormat},
+	}
+
+	for _, test := range tests {
+		info, err := Probe(bytes.NewReader(test.data), int64(len(test.data)))
+		if err != test.err {
+			t.Errorf("Probe %s got err: %v, want: %v", test.name, err, test.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if info.Format != test.format || info.Duration.Round(time.Millisecond) != test.duration {
+			t.Errorf("Probe %s got: %s %s, want: %s %s", test.name, info.Format, info.Duration, test.format, test.duration)
+		}
+	}
+}
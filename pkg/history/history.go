@@ -0,0 +1,196 @@
+// Package history implements the download history, stored as a JSON-lines file
+// with a record per song keyed by the provider and the song id.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	// Record is a downloaded song.
+	Record struct {
+		Provider string    `json:"provider"`
+		Id       string    `json:"id"`
+		Title    string    `json:"title,omitempty"`
+		Path     string    `json:"path"`
+		Size     int64     `json:"size"`
+		Hash     string    `json:"hash,omitempty"`
+		Quality  string    `json:"quality,omitempty"`
+		Time     time.Time `json:"time"`
+	}
+
+	// Store is the history loaded into memory, it's safe for concurrent use.
+	// A record is appended to the file on every change, the later line of a song wins.
+	Store struct {
+		mu      sync.Mutex
+		name    string
+		records map[string]*Record
+	}
+)
+
+// Key returns the identifier of the song of r.
+func (r *Record) Key() string {
+	return Key(r.Provider, r.Id)
+}
+
+// Key returns the identifier of a song, such as "netease:123".
+func Key(provider, id string) string {
+	return provider + ":" + id
+}
+
+// Open loads the history file, it's created on the first Put if it doesn't exist.
+// The lines failed to parse, such as one truncated by a crash, are skipped.
+func Open(name string) (*Store, error) {
+	s := &Store{name: name, records: make(map[string]*Record)}
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		r := new(Record)
+		if json.Unmarshal(scanner.Bytes(), r) != nil || r.Id == "" {
+			continue
+		}
+		s.records[r.Key()] = r
+	}
+	return s, scanner.Err()
+}
+
+// Get returns the record of the song.
+func (s *Store) Get(provider, id string) (*Record, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.records[Key(provider, id)]
+	return r, ok
+}
+
+// Put adds or replaces the record of a song and appends it to the file.
+func (s *Store) Put(r *Record) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(r); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	s.records[r.Key()] = r
+	return nil
+}
+
+// Records returns the records in time order.
+func (s *Store) Records() []*Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sorted()
+}
+
+func (s *Store) sorted() []*Record {
+	records := make([]*Record, 0, len(s.records))
+	for _, r := range s.records {
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].Time.Equal(records[j].Time) {
+			return records[i].Time.Before(records[j].Time)
+		}
+		return records[i].Key() < records[j].Key()
+	})
+	return records
+}
+
+// Prune removes the records matched by f and rewrites the file compactly,
+// then returns the removed records in time order.
+func (s *Store) Prune(f func(r *Record) bool) ([]*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept, removed := make([]*Record, 0), make([]*Record, 0)
+	for _, r := range s.sorted() {
+		if f(r) {
+			removed = append(removed, r)
+		} else {
+			kept = append(kept, r)
+		}
+	}
+	if err := s.rewrite(kept); err != nil {
+		return nil, err
+	}
+	for _, r := range removed {
+		delete(s.records, r.Key())
+	}
+	return removed, nil
+}
+
+// rewrite replaces the file with the records through a temporary file,
+// so that the history is never lost halfway.
+func (s *Store) rewrite(records []*Record) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(s.name), filepath.Base(s.name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, r := range records {
+		if err = enc.Encode(r); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err = w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.name)
+}
+
+// HashFile returns the SHA-256 digest of the file, such as "sha256:9f86...".
+func HashFile(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
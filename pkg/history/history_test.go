@@ -0,0 +1,90 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "history.jsonl")
+
+	s, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Round(0)
+	records := []*Record{
+		{Provider: "netease", Id: "1", Path: "/a <1>.mp3", Size: 3, Time: now},
+		{Provider: "qq", Id: "1", Path: "/b.m4a", Time: now.Add(-time.Hour)},
+		{Provider: "netease", Id: "1", Path: "/c.flac", Quality: "flac", Time: now.Add(time.Hour)},
+	}
+	for _, r := range records {
+		if err = s.Put(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a truncated line written by a crash is skipped
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"provider":"kuwo","id":"2","pa`)
+	f.Close()
+
+	if s, err = Open(name); err != nil {
+		t.Fatal(err)
+	}
+	got := s.Records()
+	if len(got) != 2 || got[0].Path != "/b.m4a" || got[1].Path != "/c.flac" || !got[1].Time.Equal(now.Add(time.Hour)) {
+		t.Fatalf("Records got %+v, %+v", got[0], got[1])
+	}
+	if r, ok := s.Get("netease", "1"); !ok || r.Quality != "flac" {
+		t.Errorf("Get got %+v, %v", r, ok)
+	}
+	if _, ok := s.Get("kuwo", "2"); ok {
+		t.Error("Get should miss the truncated record")
+	}
+
+	removed, err := s.Prune(func(r *Record) bool {
+		return r.Provider == "qq"
+	})
+	if err != nil || len(removed) != 1 || removed[0].Path != "/b.m4a" {
+		t.Fatalf("Prune got %v, %v", removed, err)
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 1 ||
+		!strings.Contains(lines[0], `"/c.flac"`) {
+		t.Errorf("Prune rewrote the file:\n%s", data)
+	}
+	if s, err = Open(name); err != nil || len(s.Records()) != 1 {
+		t.Errorf("Open after Prune got %v, %v", s.Records(), err)
+	}
+}
+
+func TestHashFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("test")
+	f.Close()
+
+	hash, err := HashFile(f.Name())
+	if want := "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"; err != nil || hash != want {
+		t.Errorf("HashFile got %q, %v, want %q", hash, err, want)
+	}
+}
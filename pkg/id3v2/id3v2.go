@@ -0,0 +1,370 @@
+package id3v2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	// V23 represents ID3v2.3.0
+	V23 = 3
+	// V24 represents ID3v2.4.0
+	V24 = 4
+
+	// PictureTypeFrontCover is the APIC picture type of front cover
+	PictureTypeFrontCover = 3
+
+	headerSize = 10
+
+	encodingISO88591 = 0
+	encodingUTF16    = 1
+	encodingUTF8     = 3
+
+	flagFooter = 0x10
+
+	timestampFormatMilliseconds = 2
+	contentTypeLyrics           = 1
+)
+
+var (
+	// ErrUnsupportedVersion is returned when creating a tag with an unknown version
+	ErrUnsupportedVersion = errors.New("id3v2: unsupported version")
+)
+
+type (
+	// Tag is an ID3v2 tag which would be written at the beginning of an mp3 file.
+	Tag struct {
+		version byte
+		frames  []*frame
+	}
+
+	frame struct {
+		id   string
+		body []byte
+	}
+
+	// SyncedText is a piece of text with its timestamp in the SYLT frame.
+	SyncedText struct {
+		Text      string
+		Timestamp time.Duration
+	}
+)
+
+// NewTag is used to create an empty tag with the specified version, V23 or V24.
+func NewTag(version byte) (*Tag, error) {
+	if version != V23 && version != V24 {
+		return nil, ErrUnsupportedVersion
+	}
+	return &Tag{version: version}, nil
+}
+
+// Version returns the major version of t.
+func (t *Tag) Version() byte {
+	return t.version
+}
+
+// SetTextFrame sets a text information frame, such as TIT2, replacing the existing one.
+func (t *Tag) SetTextFrame(id string, values ...string) {
+	sep := "/"
+	if t.version == V24 {
+		sep = "\x00"
+	}
+	text := strings.Join(values, sep)
+	if text == "" {
+		t.removeFrame(id)
+		return
+	}
+
+	var body bytes.Buffer
+	enc := t.textEncoding()
+	body.WriteByte(enc)
+	body.Write(encodeString(text, enc))
+	t.setFrame(id, body.Bytes())
+}
+
+// SetTitle sets the title (TIT2) of t.
+func (t *Tag) SetTitle(title string) {
+	t.SetTextFrame("TIT2", title)
+}
+
+// SetArtists sets the lead artists (TPE1) of t.
+func (t *Tag) SetArtists(artists ...string) {
+	t.SetTextFrame("TPE1", artists...)
+}
+
+// SetAlbum sets the album (TALB) of t.
+func (t *Tag) SetAlbum(album string) {
+	t.SetTextFrame("TALB", album)
+}
+
+// SetAlbumArtist sets the album artist (TPE2) of t.
+func (t *Tag) SetAlbumArtist(artist string) {
+	t.SetTextFrame("TPE2", artist)
+}
+
+// SetTrackNumber sets the track number (TRCK) of t, total is omitted if not positive.
+func (t *Tag) SetTrackNumber(track, total int) {
+	t.setNumberFrame("TRCK", track, total)
+}
+
+// SetDiscNumber sets the disc number (TPOS) of t, total is omitted if not positive.
+func (t *Tag) SetDiscNumber(disc, total int) {
+	t.setNumberFrame("TPOS", disc, total)
+}
+
+// SetYear sets the recording year of t, TYER for V23 and TDRC for V24.
+func (t *Tag) SetYear(year int) {
+	id := "TYER"
+	if t.version == V24 {
+		id = "TDRC"
+	}
+	if year <= 0 {
+		t.removeFrame(id)
+		return
+	}
+	t.SetTextFrame(id, strconv.Itoa(year))
+}
+
+// SetPicture sets an attached picture (APIC) of t, mime would be detected if empty.
+func (t *Tag) SetPicture(pictureType byte, mime string, data []byte) {
+	if mime == "" {
+		mime = detectImageMIME(data)
+	}
+
+	var body bytes.Buffer
+	body.WriteByte(encodingISO88591)
+	body.WriteString(mime)
+	body.WriteByte(0)
+	body.WriteByte(pictureType)
+	// empty description
+	body.WriteByte(0)
+	body.Write(data)
+	t.setFrame("APIC", body.Bytes())
+}
+
+// SetLyrics sets the unsynchronised lyrics (USLT) of t, lang is an ISO-639-2 code such as "chi".
+func (t *Tag) SetLyrics(lang, description, text string) {
+	if text == "" {
+		t.removeFrame("USLT")
+		return
+	}
+
+	var body bytes.Buffer
+	enc := t.textEncoding()
+	body.WriteByte(enc)
+	body.WriteString(languageCode(lang))
+	body.Write(encodeTerminatedString(description, enc))
+	body.Write(encodeString(text, enc))
+	t.setFrame("USLT", body.Bytes())
+}
+
+// SetSyncedLyrics sets the synchronised lyrics (SYLT) of t, timestamps are written in milliseconds.
+func (t *Tag) SetSyncedLyrics(lang, description string, texts []SyncedText) {
+	if len(texts) == 0 {
+		t.removeFrame("SYLT")
+		return
+	}
+
+	var body bytes.Buffer
+	enc := t.textEncoding()
+	body.WriteByte(enc)
+	body.WriteString(languageCode(lang))
+	body.WriteByte(timestampFormatMilliseconds)
+	body.WriteByte(contentTypeLyrics)
+	body.Write(encodeTerminatedString(description, enc))
+	for _, i := range texts {
+		body.Write(encodeTerminatedString(i.Text, enc))
+		binary.Write(&body, binary.BigEndian, uint32(i.Timestamp.Milliseconds()))
+	}
+	t.setFrame("SYLT", body.Bytes())
+}
+
+// Bytes returns the binary representation of t.
+func (t *Tag) Bytes() []byte {
+	var frames bytes.Buffer
+	for _, f := range t.frames {
+		frames.WriteString(f.id)
+		size := uint32(len(f.body))
+		if t.version == V24 {
+			size = synchsafe(size)
+		}
+		binary.Write(&frames, binary.BigEndian, size)
+		// frame flags
+		frames.Write([]byte{0, 0})
+		frames.Write(f.body)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("ID3")
+	buf.Write([]byte{t.version, 0, 0})
+	binary.Write(&buf, binary.BigEndian, synchsafe(uint32(frames.Len())))
+	buf.Write(frames.Bytes())
+	return buf.Bytes()
+}
+
+func (t *Tag) setNumberFrame(id string, n, total int) {
+	if n <= 0 {
+		t.removeFrame(id)
+		return
+	}
+	text := strconv.Itoa(n)
+	if total > 0 {
+		text += "/" + strconv.Itoa(total)
+	}
+	t.SetTextFrame(id, text)
+}
+
+func (t *Tag) textEncoding() byte {
+	if t.version == V24 {
+		return encodingUTF8
+	}
+	return encodingUTF16
+}
+
+func (t *Tag) setFrame(id string, body []byte) {
+	for _, f := range t.frames {
+		if f.id == id {
+			f.body = body
+			return
+		}
+	}
+	t.frames = append(t.frames, &frame{id: id, body: body})
+}
+
+func (t *Tag) removeFrame(id string) {
+	frames := t.frames[:0]
+	for _, f := range t.frames {
+		if f.id != id {
+			frames = append(frames, f)
+		}
+	}
+	t.frames = frames
+}
+
+// WriteFile writes t into the named file, the existing ID3v2 tags would be replaced.
+func WriteFile(name string, t *Tag) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	offset, err := TagSize(src)
+	if err != nil {
+		return err
+	}
+	if _, err = src.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	dst, err := ioutil.TempFile(filepath.Dir(name), ".id3v2-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(dst.Name())
+
+	if _, err = dst.Write(t.Bytes()); err == nil {
+		_, err = io.Copy(dst, src)
+	}
+	// the temporary file is owner-only, the file keeps its original mode
+	if err == nil {
+		err = dst.Chmod(fi.Mode().Perm())
+	}
+	if cErr := dst.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return err
+	}
+
+	src.Close()
+	return os.Rename(dst.Name(), name)
+}
+
+// TagSize returns the total size of the ID3v2 tags at the beginning of r, 0 if there is none.
+func TagSize(r io.ReadSeeker) (int64, error) {
+	var total int64
+	header := make([]byte, headerSize)
+	for {
+		if _, err := r.Seek(total, io.SeekStart); err != nil {
+			return 0, err
+		}
+		_, err := io.ReadFull(r, header)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return total, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if string(header[:3]) != "ID3" {
+			return total, nil
+		}
+
+		size := int64(unsynchsafe(binary.BigEndian.Uint32(header[6:])))
+		total += headerSize + size
+		if header[5]&flagFooter != 0 {
+			total += headerSize
+		}
+	}
+}
+
+func encodeString(s string, enc byte) []byte {
+	switch enc {
+	case encodingUTF16:
+		units := utf16.Encode([]rune(s))
+		b := make([]byte, 0, 2*len(units)+2)
+		// little endian BOM
+		b = append(b, 0xFF, 0xFE)
+		for _, u := range units {
+			b = append(b, byte(u), byte(u>>8))
+		}
+		return b
+	default:
+		return []byte(s)
+	}
+}
+
+func encodeTerminatedString(s string, enc byte) []byte {
+	b := encodeString(s, enc)
+	if enc == encodingUTF16 {
+		return append(b, 0, 0)
+	}
+	return append(b, 0)
+}
+
+func languageCode(lang string) string {
+	if len(lang) != 3 {
+		return "XXX"
+	}
+	return lang
+}
+
+func synchsafe(n uint32) uint32 {
+	return n&0x7F | (n&0x3F80)<<1 | (n&0x1FC000)<<2 | (n&0xFE00000)<<3
+}
+
+func unsynchsafe(n uint32) uint32 {
+	return n&0x7F | (n&0x7F00)>>1 | (n&0x7F0000)>>2 | (n&0x7F000000)>>3
+}
+
+func detectImageMIME(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("\x89PNG")):
+		return "image/png"
+	default:
+		return "image/jpeg"
+	}
+}
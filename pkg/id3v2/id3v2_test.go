@@ -0,0 +1,84 @@
+package id3v2
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTag_Bytes(t *testing.T) {
+	tag, err := NewTag(V24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag.SetTitle("晴天")
+	tag.SetArtists("周杰伦")
+	tag.SetTitle("七里香")
+
+	want := []byte("ID3\x04\x00\x00\x00\x00\x00\x28" +
+		"TIT2\x00\x00\x00\x0A\x00\x00\x03七里香" +
+		"TPE1\x00\x00\x00\x0A\x00\x00\x03周杰伦")
+	if got := tag.Bytes(); !bytes.Equal(got, want) {
+		t.Errorf("Tag.Bytes() got: %q, want: %q", got, want)
+	}
+
+	if _, err = NewTag(2); err != ErrUnsupportedVersion {
+		t.Errorf("NewTag(2) got err: %v, want: %v", err, ErrUnsupportedVersion)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "id3v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	audio := []byte{0xFF, 0xFB, 0x90, 0x64, 0x00}
+	old, _ := NewTag(V23)
+	old.SetAlbum("old album")
+
+	name := filepath.Join(dir, "test.mp3")
+	if err = ioutil.WriteFile(name, append(old.Bytes(), audio...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tag, _ := NewTag(V23)
+	tag.SetTitle("title")
+	tag.SetTrackNumber(3, 12)
+	if err = WriteFile(name, tag); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := append(tag.Bytes(), audio...); !bytes.Equal(got, want) {
+		t.Errorf("WriteFile got: %q, want: %q", got, want)
+	}
+	after, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Mode() != fi.Mode() {
+		t.Errorf("WriteFile changed the mode: %v, want: %v", after.Mode(), fi.Mode())
+	}
+}
+
+func TestSynchsafe(t *testing.T) {
+	for _, n := range []uint32{0, 0x7F, 0x80, 0x3FFF, 0x4000, 0x0FFFFFFF} {
+		if got := unsynchsafe(synchsafe(n)); got != n {
+			t.Errorf("unsynchsafe(synchsafe(%#x)) got: %#x", n, got)
+		}
+	}
+	if got := synchsafe(0x80); got != 0x100 {
+		t.Errorf("synchsafe(0x80) got: %#x, want: 0x100", got)
+	}
+}
@@ -0,0 +1,156 @@
+package lrc
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	timeTagRe = regexp.MustCompile(`^\[(\d+):(\d+)(?:[.:](\d+))?\]`)
+	idTagRe   = regexp.MustCompile(`^\[[a-zA-Z#]+:.*\]$`)
+)
+
+type (
+	// Line is a line of synchronized lyrics.
+	Line struct {
+		Time        time.Duration
+		Text        string
+		Translation string
+	}
+
+	// Lyrics holds the ID tags and the time-ordered lines of LRC lyrics.
+	Lyrics struct {
+		Tags  []string
+		Lines []*Line
+	}
+)
+
+// Parse is used to parse LRC formatted lyrics, lines without time tags would be dropped.
+func Parse(text string) *Lyrics {
+	l := &Lyrics{}
+	for _, raw := range strings.Split(text, "\n") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+
+		times := make([]time.Duration, 0, 1)
+		for {
+			matched := timeTagRe.FindStringSubmatch(raw)
+			if matched == nil {
+				break
+			}
+			times = append(times, parseTimeTag(matched))
+			raw = raw[len(matched[0]):]
+		}
+
+		if len(times) == 0 {
+			if idTagRe.MatchString(raw) {
+				l.Tags = append(l.Tags, raw)
+			}
+			continue
+		}
+
+		raw = strings.TrimSpace(raw)
+		for _, t := range times {
+			l.Lines = append(l.Lines, &Line{Time: t, Text: raw})
+		}
+	}
+
+	l.sort()
+	return l
+}
+
+func parseTimeTag(matched []string) time.Duration {
+	min, _ := strconv.Atoi(matched[1])
+	sec, _ := strconv.Atoi(matched[2])
+	d := time.Duration(min)*time.Minute + time.Duration(sec)*time.Second
+	if frac := matched[3]; frac != "" {
+		// "34" means 340 milliseconds
+		for len(frac) < 3 {
+			frac += "0"
+		}
+		ms, _ := strconv.Atoi(frac[:3])
+		d += time.Duration(ms) * time.Millisecond
+	}
+	return d
+}
+
+// Empty reports whether l has no synchronized lines.
+func (l *Lyrics) Empty() bool {
+	return l == nil || len(l.Lines) == 0
+}
+
+// Merge merges the translated lyrics into l line by line, matched by timestamp.
+// The translated lines without a matched timestamp would be kept as separate lines.
+func (l *Lyrics) Merge(translation *Lyrics) {
+	if translation.Empty() {
+		return
+	}
+
+	index := make(map[time.Duration]*Line, len(l.Lines))
+	for _, i := range l.Lines {
+		key := i.Time.Round(10 * time.Millisecond)
+		if _, ok := index[key]; !ok {
+			index[key] = i
+		}
+	}
+
+	for _, i := range translation.Lines {
+		// netease uses "//" as an empty translation
+		if i.Text == "" || i.Text == "//" {
+			continue
+		}
+		if line, ok := index[i.Time.Round(10*time.Millisecond)]; ok && line.Translation == "" {
+			line.Translation = i.Text
+			continue
+		}
+		l.Lines = append(l.Lines, &Line{Time: i.Time, Text: i.Text})
+	}
+
+	l.sort()
+}
+
+// String returns the LRC representation of l, the translation follows the original line with the same time tag.
+func (l *Lyrics) String() string {
+	var sb strings.Builder
+	for _, i := range l.Tags {
+		sb.WriteString(i)
+		sb.WriteByte('\n')
+	}
+	for _, i := range l.Lines {
+		tag := formatTimeTag(i.Time)
+		sb.WriteString(tag + i.Text + "\n")
+		if i.Translation != "" {
+			sb.WriteString(tag + i.Translation + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// Text returns the unsynchronized lyrics text of l.
+func (l *Lyrics) Text() string {
+	lines := make([]string, 0, len(l.Lines))
+	for _, i := range l.Lines {
+		lines = append(lines, i.Text)
+		if i.Translation != "" {
+			lines = append(lines, i.Translation)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (l *Lyrics) sort() {
+	sort.SliceStable(l.Lines, func(i, j int) bool {
+		return l.Lines[i].Time < l.Lines[j].Time
+	})
+}
+
+func formatTimeTag(d time.Duration) string {
+	cs := d.Milliseconds() / 10
+	return fmt.Sprintf("[%02d:%02d.%02d]", cs/6000, cs/100%60, cs%100)
+}
@@ -0,0 +1,40 @@
+package lrc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	l := Parse("[ti:晴天]\r\n[by:]\r\n[00:01.5]故事的小黄花\r\n[00:10.00][00:03.123]从出生那年就飘着\r\nnot a lyric line\r\n")
+	if len(l.Tags) != 2 {
+		t.Errorf("Parse got tags: %v", l.Tags)
+	}
+
+	want := []Line{
+		{Time: 1500 * time.Millisecond, Text: "故事的小黄花"},
+		{Time: 3123 * time.Millisecond, Text: "从出生那年就飘着"},
+		{Time: 10 * time.Second, Text: "从出生那年就飘着"},
+	}
+	if len(l.Lines) != len(want) {
+		t.Fatalf("Parse got %d lines, want: %d", len(l.Lines), len(want))
+	}
+	for i, line := range l.Lines {
+		if *line != want[i] {
+			t.Errorf("Parse got line %d: %+v, want: %+v", i, *line, want[i])
+		}
+	}
+}
+
+func TestLyrics_Merge(t *testing.T) {
+	l := Parse("[00:01.00]Hello\n[00:02.00]World\n")
+	l.Merge(Parse("[00:01.00]你好\n[00:02.00]//\n[00:03.50]尾声\n"))
+
+	want := "[00:01.00]Hello\n[00:01.00]你好\n[00:02.00]World\n[00:03.50]尾声\n"
+	if got := l.String(); got != want {
+		t.Errorf("Merge got: %q, want: %q", got, want)
+	}
+	if got, want := l.Text(), "Hello\n你好\nWorld\n尾声"; got != want {
+		t.Errorf("Text got: %q, want: %q", got, want)
+	}
+}
@@ -0,0 +1,446 @@
+package mp4meta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	typeUTF8     = 1
+	typeJPEG     = 13
+	typePNG      = 14
+	typeImplicit = 0
+)
+
+var (
+	// ErrMoovNotFound is returned when the file has no moov atom
+	ErrMoovNotFound = errors.New("mp4meta: moov atom not found")
+	// ErrInvalidAtom is returned when an atom's size is out of range
+	ErrInvalidAtom = errors.New("mp4meta: invalid atom")
+	// ErrOffsetOverflow is returned when a shifted stco chunk offset overflows 32 bits
+	ErrOffsetOverflow = errors.New("mp4meta: chunk offset overflow")
+
+	containers = map[string]bool{
+		"moov": true,
+		"trak": true,
+		"mdia": true,
+		"minf": true,
+		"stbl": true,
+		"edts": true,
+		"udta": true,
+		"meta": true,
+		"ilst": true,
+	}
+)
+
+type (
+	// Tag is a set of iTunes-style metadata items which would be written into moov/udta/meta/ilst.
+	Tag struct {
+		items []*atom
+	}
+
+	atom struct {
+		typ      string
+		prefix   []byte
+		data     []byte
+		children []*atom
+	}
+
+	atomHeader struct {
+		typ        string
+		offset     int64
+		size       int64
+		headerSize int64
+	}
+)
+
+// NewTag is used to create an empty tag.
+func NewTag() *Tag {
+	return &Tag{}
+}
+
+// SetTitle sets the title (©nam) of t.
+func (t *Tag) SetTitle(title string) {
+	t.setText("\xa9nam", title)
+}
+
+// SetArtists sets the artists (©ART) of t.
+func (t *Tag) SetArtists(artists ...string) {
+	t.setText("\xa9ART", strings.Join(artists, ", "))
+}
+
+// SetAlbum sets the album (©alb) of t.
+func (t *Tag) SetAlbum(album string) {
+	t.setText("\xa9alb", album)
+}
+
+// SetAlbumArtist sets the album artist (aART) of t.
+func (t *Tag) SetAlbumArtist(artist string) {
+	t.setText("aART", artist)
+}
+
+// SetTrackNumber sets the track number (trkn) of t, total is omitted if not positive.
+func (t *Tag) SetTrackNumber(track, total int) {
+	t.setNumber("trkn", track, total, 8)
+}
+
+// SetDiscNumber sets the disc number (disk) of t, total is omitted if not positive.
+func (t *Tag) SetDiscNumber(disc, total int) {
+	t.setNumber("disk", disc, total, 6)
+}
+
+// SetYear sets the release year (©day) of t.
+func (t *Tag) SetYear(year int) {
+	if year <= 0 {
+		t.removeItem("\xa9day")
+		return
+	}
+	t.setText("\xa9day", strconv.Itoa(year))
+}
+
+// SetLyrics sets the unsynchronized lyrics (©lyr) of t.
+func (t *Tag) SetLyrics(text string) {
+	t.setText("\xa9lyr", text)
+}
+
+// SetPicture sets the cover art (covr) of t, JPEG and PNG are supported.
+func (t *Tag) SetPicture(data []byte) {
+	typ := typeJPEG
+	if bytes.HasPrefix(data, []byte("\x89PNG")) {
+		typ = typePNG
+	}
+	t.setItem("covr", typ, data)
+}
+
+func (t *Tag) setText(typ, text string) {
+	if text == "" {
+		t.removeItem(typ)
+		return
+	}
+	t.setItem(typ, typeUTF8, []byte(text))
+}
+
+func (t *Tag) setNumber(typ string, n, total, size int) {
+	if n <= 0 {
+		t.removeItem(typ)
+		return
+	}
+	if total < 0 {
+		total = 0
+	}
+	value := make([]byte, size)
+	binary.BigEndian.PutUint16(value[2:], uint16(n))
+	binary.BigEndian.PutUint16(value[4:], uint16(total))
+	t.setItem(typ, typeImplicit, value)
+}
+
+func (t *Tag) setItem(typ string, dataType int, value []byte) {
+	payload := make([]byte, 8, 8+len(value))
+	binary.BigEndian.PutUint32(payload, uint32(dataType))
+	payload = append(payload, value...)
+
+	item := &atom{
+		typ:      typ,
+		children: []*atom{{typ: "data", data: payload}},
+	}
+	for i, a := range t.items {
+		if a.typ == typ {
+			t.items[i] = item
+			return
+		}
+	}
+	t.items = append(t.items, item)
+}
+
+func (t *Tag) removeItem(typ string) {
+	items := t.items[:0]
+	for _, a := range t.items {
+		if a.typ != typ {
+			items = append(items, a)
+		}
+	}
+	t.items = items
+}
+
+func (t *Tag) apply(ilst *atom) {
+	set := make(map[string]bool, len(t.items))
+	for _, a := range t.items {
+		set[a.typ] = true
+	}
+
+	children := make([]*atom, 0, len(ilst.children)+len(t.items))
+	for _, a := range ilst.children {
+		if !set[a.typ] {
+			children = append(children, a)
+		}
+	}
+	ilst.children = append(children, t.items...)
+}
+
+// WriteFile writes t into the named MP4/M4A file in place,
+// the chunk offsets (stco/co64) would be fixed up if the moov atom precedes the media data.
+func WriteFile(name string, t *Tag) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	headers, err := readAtomHeaders(src, fi.Size())
+	if err != nil {
+		return err
+	}
+
+	var moovHeader *atomHeader
+	for _, h := range headers {
+		if h.typ == "moov" {
+			moovHeader = h
+			break
+		}
+	}
+	if moovHeader == nil {
+		return ErrMoovNotFound
+	}
+
+	payload := make([]byte, moovHeader.size-moovHeader.headerSize)
+	if _, err = src.ReadAt(payload, moovHeader.offset+moovHeader.headerSize); err != nil {
+		return err
+	}
+	moov, err := parseAtom("moov", payload)
+	if err != nil {
+		return err
+	}
+
+	t.apply(moov.ensurePath("udta", "meta", "ilst"))
+	delta := moov.size() - moovHeader.size
+	if delta != 0 {
+		if err = shiftChunkOffsets(moov, moovHeader.offset, delta); err != nil {
+			return err
+		}
+	}
+
+	dst, err := ioutil.TempFile(filepath.Dir(name), ".mp4meta-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(dst.Name())
+
+	var buf bytes.Buffer
+	moov.writeTo(&buf)
+	if _, err = io.Copy(dst, io.NewSectionReader(src, 0, moovHeader.offset)); err == nil {
+		if _, err = dst.Write(buf.Bytes()); err == nil {
+			end := moovHeader.offset + moovHeader.size
+			_, err = io.Copy(dst, io.NewSectionReader(src, end, fi.Size()-end))
+		}
+	}
+	// the temporary file is owner-only, the file keeps its original mode
+	if err == nil {
+		err = dst.Chmod(fi.Mode().Perm())
+	}
+	if cErr := dst.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return err
+	}
+
+	src.Close()
+	return os.Rename(dst.Name(), name)
+}
+
+func readAtomHeaders(r io.ReaderAt, fileSize int64) ([]*atomHeader, error) {
+	headers := make([]*atomHeader, 0)
+	buf := make([]byte, 16)
+	for offset := int64(0); offset < fileSize; {
+		if _, err := r.ReadAt(buf[:8], offset); err != nil {
+			return nil, err
+		}
+
+		h := &atomHeader{
+			typ:        string(buf[4:8]),
+			offset:     offset,
+			size:       int64(binary.BigEndian.Uint32(buf)),
+			headerSize: 8,
+		}
+		switch h.size {
+		case 0:
+			h.size = fileSize - offset
+		case 1:
+			if _, err := r.ReadAt(buf[8:16], offset+8); err != nil {
+				return nil, err
+			}
+			h.size = int64(binary.BigEndian.Uint64(buf[8:16]))
+			h.headerSize = 16
+		}
+		if h.size < h.headerSize || offset+h.size > fileSize {
+			return nil, ErrInvalidAtom
+		}
+
+		headers = append(headers, h)
+		offset += h.size
+	}
+	return headers, nil
+}
+
+func parseAtom(typ string, payload []byte) (*atom, error) {
+	a := &atom{typ: typ}
+	if !containers[typ] {
+		a.data = payload
+		return a, nil
+	}
+
+	// ISO meta is a full box, QuickTime meta is not
+	if typ == "meta" && len(payload) >= 8 && string(payload[4:8]) != "hdlr" {
+		a.prefix, payload = payload[:4], payload[4:]
+	}
+
+	for len(payload) > 0 {
+		if len(payload) < 8 {
+			return nil, ErrInvalidAtom
+		}
+
+		size, headerSize := uint64(binary.BigEndian.Uint32(payload)), uint64(8)
+		childType := string(payload[4:8])
+		switch size {
+		case 0:
+			size = uint64(len(payload))
+		case 1:
+			if len(payload) < 16 {
+				return nil, ErrInvalidAtom
+			}
+			size, headerSize = binary.BigEndian.Uint64(payload[8:]), 16
+		}
+		if size < headerSize || size > uint64(len(payload)) {
+			return nil, ErrInvalidAtom
+		}
+
+		child, err := parseAtom(childType, payload[headerSize:size])
+		if err != nil {
+			return nil, err
+		}
+		a.children = append(a.children, child)
+		payload = payload[size:]
+	}
+	return a, nil
+}
+
+func (a *atom) child(typ string) *atom {
+	for _, c := range a.children {
+		if c.typ == typ {
+			return c
+		}
+	}
+	return nil
+}
+
+func (a *atom) ensurePath(types ...string) *atom {
+	cur := a
+	for _, typ := range types {
+		next := cur.child(typ)
+		if next == nil {
+			next = &atom{typ: typ}
+			if typ == "meta" {
+				next.prefix = make([]byte, 4)
+				next.children = []*atom{metaHandler()}
+			}
+			cur.children = append(cur.children, next)
+		}
+		cur = next
+	}
+	return cur
+}
+
+func metaHandler() *atom {
+	data := make([]byte, 25)
+	copy(data[8:], "mdir")
+	copy(data[12:], "appl")
+	return &atom{typ: "hdlr", data: data}
+}
+
+func (a *atom) size() int64 {
+	n := int64(8 + len(a.prefix) + len(a.data))
+	for _, c := range a.children {
+		n += c.size()
+	}
+	if n > math.MaxUint32 {
+		n += 8
+	}
+	return n
+}
+
+func (a *atom) writeTo(buf *bytes.Buffer) {
+	size := a.size()
+	if size > math.MaxUint32 {
+		binary.Write(buf, binary.BigEndian, uint32(1))
+		buf.WriteString(a.typ)
+		binary.Write(buf, binary.BigEndian, uint64(size))
+	} else {
+		binary.Write(buf, binary.BigEndian, uint32(size))
+		buf.WriteString(a.typ)
+	}
+	buf.Write(a.prefix)
+	buf.Write(a.data)
+	for _, c := range a.children {
+		c.writeTo(buf)
+	}
+}
+
+func shiftChunkOffsets(a *atom, from, delta int64) error {
+	switch a.typ {
+	case "stco":
+		if len(a.data) < 8 {
+			return ErrInvalidAtom
+		}
+		n := int(binary.BigEndian.Uint32(a.data[4:]))
+		if len(a.data) < 8+4*n {
+			return ErrInvalidAtom
+		}
+		for i := 0; i < n; i++ {
+			p := a.data[8+4*i:]
+			offset := int64(binary.BigEndian.Uint32(p))
+			if offset < from {
+				continue
+			}
+			offset += delta
+			if offset < 0 || offset > math.MaxUint32 {
+				return ErrOffsetOverflow
+			}
+			binary.BigEndian.PutUint32(p, uint32(offset))
+		}
+	case "co64":
+		if len(a.data) < 8 {
+			return ErrInvalidAtom
+		}
+		n := int(binary.BigEndian.Uint32(a.data[4:]))
+		if len(a.data) < 8+8*n {
+			return ErrInvalidAtom
+		}
+		for i := 0; i < n; i++ {
+			p := a.data[8+8*i:]
+			offset := int64(binary.BigEndian.Uint64(p))
+			if offset >= from {
+				binary.BigEndian.PutUint64(p, uint64(offset+delta))
+			}
+		}
+	}
+
+	for _, c := range a.children {
+		if err := shiftChunkOffsets(c, from, delta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
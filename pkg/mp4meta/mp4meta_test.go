@@ -0,0 +1,102 @@
+package mp4meta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func buildAtom(typ string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	b := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(b, uint32(8+len(body)))
+	copy(b[4:], typ)
+	return append(b, body...)
+}
+
+func buildFile(samples []byte) []byte {
+	ftyp := buildAtom("ftyp", []byte("M4A \x00\x00\x00\x00"))
+	stco := func(offset uint32) []byte {
+		data := make([]byte, 12)
+		binary.BigEndian.PutUint32(data[4:], 1)
+		binary.BigEndian.PutUint32(data[8:], offset)
+		return buildAtom("stco", data)
+	}
+
+	moovSize := len(buildAtom("moov", buildAtom("trak", buildAtom("mdia", buildAtom("minf", buildAtom("stbl", stco(0)))))))
+	offset := uint32(len(ftyp) + moovSize + 8)
+	moov := buildAtom("moov", buildAtom("trak", buildAtom("mdia", buildAtom("minf", buildAtom("stbl", stco(offset))))))
+	return bytes.Join([][]byte{ftyp, moov, buildAtom("mdat", samples)}, nil)
+}
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mp4meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	samples := []byte("audio samples")
+	name := filepath.Join(dir, "test.m4a")
+	if err = ioutil.WriteFile(name, buildFile(samples), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tag := NewTag()
+	tag.SetTitle("晴天")
+	tag.SetArtists("周杰伦")
+	tag.SetAlbum("叶惠美")
+	tag.SetTrackNumber(3, 11)
+	tag.SetYear(2003)
+	tag.SetPicture([]byte("\xFF\xD8\xFF\xE0cover"))
+	for i := 0; i < 2; i++ {
+		if err = WriteFile(name, tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	after, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Mode() != fi.Mode() {
+		t.Errorf("WriteFile changed the mode: %v, want: %v", after.Mode(), fi.Mode())
+	}
+
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers, err := readAtomHeaders(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(headers) != 3 || headers[1].typ != "moov" {
+		t.Fatalf("unexpected top level atoms: %d", len(headers))
+	}
+
+	moov, err := parseAtom("moov", data[headers[1].offset+8:headers[1].offset+headers[1].size])
+	if err != nil {
+		t.Fatal(err)
+	}
+	ilst := moov.ensurePath("udta", "meta", "ilst")
+	if n := len(ilst.children); n != 6 {
+		t.Errorf("ilst items got: %d, want: 6", n)
+	}
+	if title := ilst.child("\xa9nam"); title == nil || string(title.data[16:]) != "晴天" {
+		t.Error("title item mismatch")
+	}
+
+	stco := moov.ensurePath("trak", "mdia", "minf", "stbl", "stco")
+	offset := binary.BigEndian.Uint32(stco.data[8:])
+	if got := data[offset : int(offset)+len(samples)]; !bytes.Equal(got, samples) {
+		t.Errorf("chunk offset points to: %q, want: %q", got, samples)
+	}
+}
@@ -0,0 +1,108 @@
+// Package pathtemplate implements the templates of file paths, such as "{artist}/{album}/{track:02} {title}.{ext}".
+// A field is written as {name} or {name:0N}, the latter pads a number with zeros to N digits.
+package pathtemplate
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type (
+	Template struct {
+		parts []part
+	}
+
+	part struct {
+		literal string
+		field   string
+		width   int
+	}
+)
+
+// Parse parses the template s.
+func Parse(s string) (*Template, error) {
+	t := new(Template)
+	for s != "" {
+		i := strings.IndexAny(s, "{}")
+		if i < 0 {
+			t.parts = append(t.parts, part{literal: s})
+			break
+		}
+		if s[i] == '}' {
+			return nil, fmt.Errorf("unexpected \"}\" at %q", s[i:])
+		}
+		if i > 0 {
+			t.parts = append(t.parts, part{literal: s[:i]})
+		}
+
+		j := strings.IndexByte(s[i:], '}')
+		if j < 0 {
+			return nil, fmt.Errorf("unclosed \"{\" at %q", s[i:])
+		}
+		p, err := parseField(s[i+1 : i+j])
+		if err != nil {
+			return nil, err
+		}
+		t.parts = append(t.parts, p)
+		s = s[i+j+1:]
+	}
+	return t, nil
+}
+
+func parseField(s string) (part, error) {
+	name, format := s, ""
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		name, format = s[:i], s[i+1:]
+	}
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || strings.ContainsAny(name, "{") {
+		return part{}, fmt.Errorf("invalid field: {%s}", s)
+	}
+
+	p := part{field: name}
+	if format != "" {
+		width, err := strconv.Atoi(format)
+		if err != nil || width < 1 || !strings.HasPrefix(format, "0") {
+			return part{}, fmt.Errorf("invalid format of field: {%s}", s)
+		}
+		p.width = width
+	}
+	return p, nil
+}
+
+// Fields returns the names of the fields in order.
+func (t *Template) Fields() []string {
+	fields := make([]string, 0, len(t.parts))
+	for _, p := range t.parts {
+		if p.field != "" {
+			fields = append(fields, p.field)
+		}
+	}
+	return fields
+}
+
+// Execute replaces the fields with the values, a value is a string or an int.
+// Missing fields and zero numbers are replaced with empty strings.
+func (t *Template) Execute(values map[string]interface{}) string {
+	var sb strings.Builder
+	for _, p := range t.parts {
+		if p.field == "" {
+			sb.WriteString(p.literal)
+			continue
+		}
+
+		switch v := values[p.field].(type) {
+		case string:
+			sb.WriteString(v)
+		case int:
+			if v != 0 {
+				sb.WriteString(fmt.Sprintf("%0*d", p.width, v))
+			}
+		case nil:
+		default:
+			sb.WriteString(fmt.Sprint(v))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,52 @@
+package pathtemplate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tmpl, err := Parse("{albumartist}/{year} - {album}/{disc:02}-{Track:02} {title}.{ext}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"albumartist", "year", "album", "disc", "track", "title", "ext"}
+	if got := tmpl.Fields(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Fields got: %v, want: %v", got, want)
+	}
+
+	for _, s := range []string{"{title", "title}", "{}", "{track:2}", "{track:0x}", "{a{b}"} {
+		if _, err = Parse(s); err == nil {
+			t.Errorf("Parse(%q) should fail", s)
+		}
+	}
+}
+
+func TestTemplate_Execute(t *testing.T) {
+	tmpl, err := Parse("{albumartist}/{year} - {album}/{disc:02}-{track:02} {title}.{ext}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := map[string]interface{}{
+		"albumartist": "周杰伦",
+		"year":        2003,
+		"album":       "叶惠美",
+		"disc":        1,
+		"track":       3,
+		"title":       "晴天",
+		"ext":         "flac",
+	}
+	want := "周杰伦/2003 - 叶惠美/01-03 晴天.flac"
+	if got := tmpl.Execute(values); got != want {
+		t.Errorf("Execute got: %q, want: %q", got, want)
+	}
+
+	values["year"], values["disc"] = 0, 0
+	delete(values, "albumartist")
+	want = "/ - 叶惠美/-03 晴天.flac"
+	if got := tmpl.Execute(values); got != want {
+		t.Errorf("Execute with missing values got: %q, want: %q", got, want)
+	}
+}
@@ -0,0 +1,129 @@
+// Package ratelimit implements a token bucket to limit the bandwidth or the request rate.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket refilled at a constant rate, it's safe for concurrent use.
+// Tokens can be taken in advance, the caller waits until the debt is paid off.
+type Bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket creates a full bucket refilled with rate tokens per second, holding burst tokens at most.
+func NewBucket(rate float64, burst int) *Bucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Bucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// Burst returns the capacity of b.
+func (b *Bucket) Burst() int {
+	return int(b.burst)
+}
+
+// Wait takes n tokens from b, it blocks until the tokens are available or ctx is done.
+func (b *Bucket) Wait(ctx context.Context, n int) error {
+	d := b.reserve(time.Now(), n)
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// reserve takes n tokens at now, and returns how long to wait before they're available.
+func (b *Bucket) reserve(now time.Time, n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.last.IsZero() && now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	if now.After(b.last) {
+		b.last = now
+	}
+
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+type reader struct {
+	ctx context.Context
+	r   io.Reader
+	b   *Bucket
+}
+
+// NewReader returns a reader reading r no faster than the rate of b in bytes per second.
+func NewReader(ctx context.Context, r io.Reader, b *Bucket) io.Reader {
+	return &reader{ctx: ctx, r: r, b: b}
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if burst := r.b.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if wErr := r.b.Wait(r.ctx, n); wErr != nil && err == nil {
+			err = wErr
+		}
+	}
+	return n, err
+}
+
+// ParseRate parses a rate in bytes per second, such as "2M", "500k", "1.5MB" or "65536",
+// the units are multiples of 1024.
+func ParseRate(s string) (int64, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	v = strings.TrimSuffix(v, "B")
+	unit := 1.0
+	if n := len(v); n > 0 {
+		switch v[n-1] {
+		case 'K':
+			unit = 1 << 10
+		case 'M':
+			unit = 1 << 20
+		case 'G':
+			unit = 1 << 30
+		}
+		if unit > 1 {
+			v = v[:n-1]
+		}
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f <= 0 {
+		return 0, fmt.Errorf("invalid rate: %q", s)
+	}
+	return int64(f * unit), nil
+}
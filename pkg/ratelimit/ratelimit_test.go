@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestBucket_Reserve(t *testing.T) {
+	b := NewBucket(100, 50)
+	now := time.Now()
+
+	if d := b.reserve(now, 50); d != 0 {
+		t.Errorf("reserve burst got wait: %s, want: 0", d)
+	}
+	if d := b.reserve(now, 10); d != 100*time.Millisecond {
+		t.Errorf("reserve beyond burst got wait: %s, want: 100ms", d)
+	}
+	// the debt of 10 tokens is paid off after 100ms
+	if d := b.reserve(now.Add(300*time.Millisecond), 20); d != 0 {
+		t.Errorf("reserve after refill got wait: %s, want: 0", d)
+	}
+	// refill never exceeds the burst
+	if d := b.reserve(now.Add(time.Hour), 60); d != 100*time.Millisecond {
+		t.Errorf("reserve after long idle got wait: %s, want: 100ms", d)
+	}
+}
+
+func TestBucket_WaitCanceled(t *testing.T) {
+	b := NewBucket(1, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := b.Wait(ctx, 10); err != context.Canceled {
+		t.Errorf("Wait got: %v, want: %v", err, context.Canceled)
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	data := bytes.Repeat([]byte("a"), 300)
+	b := NewBucket(1000, 100)
+
+	start := time.Now()
+	got, err := ioutil.ReadAll(NewReader(context.Background(), bytes.NewReader(data), b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("NewReader got %d bytes, want: %d", len(got), len(data))
+	}
+	// 100 bytes of burst, then 200 bytes at 1000 bytes per second
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("NewReader read too fast: %s", elapsed)
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int64
+		ok   bool
+	}{
+		{"2M", 2 << 20, true},
+		{"500k", 500 << 10, true},
+		{"1.5MB", 3 << 19, true},
+		{"65536", 65536, true},
+		{"1g", 1 << 30, true},
+		{"", 0, false},
+		{"M", 0, false},
+		{"-1M", 0, false},
+		{"2X", 0, false},
+	}
+
+	for _, test := range tests {
+		got, err := ParseRate(test.s)
+		if (err == nil) != test.ok || got != test.want {
+			t.Errorf("ParseRate(%q) got: %d, %v, want: %d", test.s, got, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package thumbnail
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestFit(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 100, 50))
+	for y := 0; y < 50; y++ {
+		for x := 0; x < 100; x++ {
+			src.Set(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		maxSize int
+		want    image.Point
+	}{
+		{maxSize: 40, want: image.Pt(40, 20)},
+		{maxSize: 0, want: image.Pt(100, 50)},
+		{maxSize: 200, want: image.Pt(100, 50)},
+	}
+	for _, test := range tests {
+		data, err := Fit(buf.Bytes(), test.maxSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Fit(%d) should return a JPEG image: %s", test.maxSize, err)
+		}
+		if got := img.Bounds().Size(); got != test.want {
+			t.Errorf("Fit(%d) got size: %v, want: %v", test.maxSize, got, test.want)
+		}
+	}
+}
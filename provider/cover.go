@@ -0,0 +1,129 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+
+	"github.com/winterssy/easylog"
+	"github.com/winterssy/music-get/conf"
+	"github.com/winterssy/music-get/pkg/thumbnail"
+	"github.com/winterssy/music-get/utils"
+	"github.com/winterssy/sreq"
+)
+
+const (
+	CoverFileName = "cover.jpg"
+	// the tracks of an album are usually adjacent in the download queue
+	MaxCachedCoversCount = 32
+)
+
+type (
+	coverEntry struct {
+		once sync.Once
+		data []byte
+	}
+)
+
+var (
+	coverMux    sync.Mutex
+	coverCache  = make(map[string]*coverEntry)
+	coverOrder  = make([]string, 0, MaxCachedCoversCount)
+	savedCovers = make(map[string]bool)
+)
+
+// cover returns the cover image of m, it's fetched only once for the tracks sharing the same cover.
+func (m *MP3) cover(ctx context.Context) []byte {
+	if m.Track == nil || m.Track.CoverURL == "" {
+		return nil
+	}
+
+	url := m.Track.CoverURL
+	coverMux.Lock()
+	entry, ok := coverCache[url]
+	if !ok {
+		if len(coverOrder) == MaxCachedCoversCount {
+			delete(coverCache, coverOrder[0])
+			coverOrder = coverOrder[1:]
+		}
+		entry = &coverEntry{}
+		coverCache[url] = entry
+		coverOrder = append(coverOrder, url)
+	}
+	coverMux.Unlock()
+
+	entry.once.Do(func() {
+		entry.data = m.fetchCover(ctx)
+	})
+	return entry.data
+}
+
+func (m *MP3) fetchCover(ctx context.Context) []byte {
+	easylog.Debugf("Cover URL: %s", m.Track.CoverURL)
+	data, err := Retry(ctx, func() *sreq.Response {
+		return Client(m.Provider).Get(m.Track.CoverURL, sreq.WithContext(ctx))
+	}).EnsureStatusOk().Raw()
+	if err != nil {
+		easylog.Warnf("Fetch cover failed: %s: %s", m.FileName, err.Error())
+		return nil
+	}
+
+	if conf.Conf.CoverMaxSize > 0 {
+		fitted, err := thumbnail.Fit(data, conf.Conf.CoverMaxSize)
+		if err != nil {
+			easylog.Debugf("Resize cover failed, use the original one: %s", err.Error())
+			return data
+		}
+		data = fitted
+	}
+	return data
+}
+
+// saveCover saves the cover of m as cover.jpg into the album directory,
+// it's skipped for the songs saved to the download directory directly.
+func (m *MP3) saveCover(ctx context.Context, dir string) error {
+	if filepath.Clean(dir) == filepath.Clean(conf.Conf.DownloadDir) {
+		return nil
+	}
+
+	coverPath := filepath.Join(dir, CoverFileName)
+	coverMux.Lock()
+	saved := savedCovers[coverPath]
+	coverMux.Unlock()
+	if saved {
+		return nil
+	}
+
+	if !conf.Conf.DownloadOverwrite {
+		if exists, _ := utils.ExistsPath(coverPath); exists {
+			return nil
+		}
+	}
+
+	data := m.cover(ctx)
+	if len(data) == 0 {
+		return nil
+	}
+
+	if !bytes.HasPrefix(data, []byte("\xFF\xD8")) {
+		jpeg, err := thumbnail.Fit(data, 0)
+		if err != nil {
+			return err
+		}
+		data = jpeg
+	}
+
+	// the cover is saved once for the album, the other tracks try again if it failed
+	coverMux.Lock()
+	defer coverMux.Unlock()
+	if savedCovers[coverPath] {
+		return nil
+	}
+	if err := ioutil.WriteFile(coverPath, data, 0644); err != nil {
+		return err
+	}
+	savedCovers[coverPath] = true
+	return nil
+}
@@ -0,0 +1,41 @@
+package provider
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/winterssy/music-get/conf"
+)
+
+func TestMP3_SaveCover(t *testing.T) {
+	cover := []byte("\xFF\xD8\xFF\xE0cover")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(cover)
+	}))
+	defer srv.Close()
+	root := testDir(t)
+	defer os.RemoveAll(root)
+	conf.Conf.DownloadDir = root
+
+	m := &MP3{FileName: "a.mp3", Provider: NetEaseMusic, Track: &Track{CoverURL: srv.URL + "/cover.jpg"}}
+	dir := filepath.Join(root, "album")
+	// the album directory is missing, so the first save fails
+	if err := m.saveCover(context.Background(), dir); err == nil {
+		t.Fatal("saveCover should fail without the album directory")
+	}
+
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.saveCover(context.Background(), dir); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dir, CoverFileName)); err != nil || string(data) != string(cover) {
+		t.Errorf("saveCover got %q, %v, want %q", data, err, cover)
+	}
+}
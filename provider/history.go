@@ -0,0 +1,65 @@
+package provider
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/winterssy/easylog"
+	"github.com/winterssy/music-get/pkg/history"
+)
+
+var (
+	downloadHistory *history.Store
+)
+
+// UseHistory makes the downloads consult and record the history store, nil disables it.
+func UseHistory(s *history.Store) {
+	downloadHistory = s
+}
+
+// HistoryRecord returns the history record of m, so that it's not downloaded again
+// even if the file is moved or renamed.
+func HistoryRecord(m *MP3) (*history.Record, bool) {
+	if downloadHistory == nil || m.Track == nil || m.Track.Id == "" {
+		return nil, false
+	}
+	return downloadHistory.Get(PlatformName(m.Provider), m.Track.Id)
+}
+
+// recordHistory records the file of m into the history store, errors are logged only.
+func (m *MP3) recordHistory(fPath string) {
+	if downloadHistory == nil || m.Track == nil || m.Track.Id == "" {
+		return
+	}
+
+	fi, err := os.Stat(fPath)
+	if err != nil {
+		easylog.Warnf("Record history failed: %s: %s", m.FileName, err.Error())
+		return
+	}
+	hash, err := history.HashFile(fPath)
+	if err != nil {
+		easylog.Warnf("Record history failed: %s: %s", m.FileName, err.Error())
+		return
+	}
+	quality := strings.TrimPrefix(filepath.Ext(fPath), ".")
+	if m.Track.BitRate > 0 {
+		quality = fmt.Sprintf("%s %dk", quality, m.Track.BitRate)
+	}
+	err = downloadHistory.Put(&history.Record{
+		Provider: PlatformName(m.Provider),
+		Id:       m.Track.Id,
+		Title:    m.Track.Title,
+		Path:     fPath,
+		Size:     fi.Size(),
+		Hash:     hash,
+		Quality:  quality,
+		Time:     time.Now(),
+	})
+	if err != nil {
+		easylog.Warnf("Record history failed: %s: %s", m.FileName, err.Error())
+	}
+}
@@ -1,10 +1,15 @@
 package kugou
 
 import (
+	"context"
 	"crypto/md5"
 	"errors"
 	"fmt"
+	"net/http"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/winterssy/easylog"
 	"github.com/winterssy/music-get/provider"
@@ -21,6 +26,9 @@ const (
 	GetAlbumSongs    = "http://mobilecdn.kugou.com/api/v3/album/song?page=1&pagesize=-1"
 	GetPlaylistInfo  = "http://mobilecdn.kugou.com/api/v3/special/info"
 	GetPlaylistSongs = "http://mobilecdn.kugou.com/api/v3/special/song?page=1&pagesize=-1"
+	SearchLyrics     = "http://krcs.kugou.com/search?ver=1&man=yes&client=mobi"
+	GetLyrics        = "http://lyrics.kugou.com/download?ver=1&client=pc&fmt=lrc&charset=utf8"
+	Search           = "http://mobilecdn.kugou.com/api/v3/search/song?format=json&page=1"
 )
 
 type (
@@ -42,6 +50,8 @@ type (
 		FileName   string `json:"fileName"`
 		ExtName    string `json:"extName"`
 		Hash       string `json:"hash"`
+		TimeLength int    `json:"timeLength"`
+		ImgURL     string `json:"imgUrl"`
 		Extra      struct {
 			SQHash string `json:"sqhash"`
 			PQHash string `json:"128hash"`
@@ -83,6 +93,7 @@ type (
 	AlbumRequest struct {
 		AlbumId   string
 		AlbumName string
+		Album     Album
 		Params    sreq.Params
 		Response  AlbumResponse
 	}
@@ -101,6 +112,30 @@ type (
 		Params      sreq.Params
 		Response    PlaylistResponse
 	}
+
+	LyricsResponse struct {
+		Status  int    `json:"status"`
+		Info    string `json:"info"`
+		Content string `json:"content"`
+	}
+
+	LyricsRequest struct {
+		Params   sreq.Params
+		Response LyricsResponse
+	}
+
+	SearchResponse struct {
+		Data struct {
+			Info []*SearchSong `json:"info"`
+		} `json:"data"`
+		Status int    `json:"status"`
+		Error  string `json:"error"`
+	}
+
+	SearchRequest struct {
+		Params   sreq.Params
+		Response SearchResponse
+	}
 )
 
 func NewSongURLRequest(hash string) *SongURLRequest {
@@ -113,9 +148,9 @@ func NewSongURLRequest(hash string) *SongURLRequest {
 	return &SongURLRequest{Params: params}
 }
 
-func (s *SongURLRequest) Do() error {
+func (s *SongURLRequest) Do(ctx context.Context) error {
 	easylog.Debug("SongURLRequest: send GetSongURL api request")
-	err := request(GetSongURL,
+	err := request(ctx, GetSongURL,
 		sreq.WithQuery(s.Params),
 		sreq.WithHeaders(sreq.Headers{
 			"Origin":  "http://trackercdn.kugou.com",
@@ -152,9 +187,9 @@ func (s *SongRequest) Login() error {
 	panic("implement me")
 }
 
-func (s *SongRequest) Do() error {
+func (s *SongRequest) Do(ctx context.Context) error {
 	easylog.Debug("SongRequest: send GetSong api request")
-	err := request(GetSong,
+	err := request(ctx, GetSong,
 		sreq.WithQuery(s.Params),
 		sreq.WithHeaders(sreq.Headers{
 			"Origin":  "http://m.kugou.com",
@@ -173,15 +208,21 @@ func (s *SongRequest) Do() error {
 	return nil
 }
 
-func (s *SongRequest) Prepare() ([]*provider.MP3, error) {
+func (s *SongRequest) Prepare(ctx context.Context) ([]*provider.MP3, error) {
 	songs := []*Song{
 		{
-			FileName: s.Response.FileName,
-			ExtName:  s.Response.ExtName,
-			Hash:     s.Response.Hash,
+			FileName:   s.Response.FileName,
+			ExtName:    s.Response.ExtName,
+			Hash:       s.Response.Hash,
+			HQHash:     s.Response.Extra.HQHash,
+			SQHash:     s.Response.Extra.SQHash,
+			Duration:   s.Response.TimeLength,
+			SongName:   s.Response.SongName,
+			SingerName: s.Response.SingerName,
+			ImgURL:     s.Response.ImgURL,
 		},
 	}
-	return prepare(songs, ".")
+	return prepare(ctx, songs, ".")
 }
 
 func NewArtistRequest(singerId string) *ArtistRequest {
@@ -202,7 +243,7 @@ func (a *ArtistRequest) Login() error {
 	panic("implement me")
 }
 
-func (a *ArtistRequest) Do() error {
+func (a *ArtistRequest) Do(ctx context.Context) error {
 	var data struct {
 		Data   Artist `json:"data"`
 		Status int    `json:"status"`
@@ -210,7 +251,7 @@ func (a *ArtistRequest) Do() error {
 	}
 
 	easylog.Debug("ArtistRequest: send GetArtistInfo api request")
-	err := request(GetArtistInfo,
+	err := request(ctx, GetArtistInfo,
 		sreq.WithQuery(sreq.Params{
 			"singerid": a.SingerId,
 		}),
@@ -231,7 +272,7 @@ func (a *ArtistRequest) Do() error {
 	a.SingerName = data.Data.SingerName
 
 	easylog.Debug("ArtistRequest: send GetArtistSongs api request")
-	err = request(GetArtistSongs,
+	err = request(ctx, GetArtistSongs,
 		sreq.WithQuery(a.Params),
 		sreq.WithHeaders(sreq.Headers{
 			"Origin":  "http://mobilecdn.kugou.com",
@@ -254,9 +295,9 @@ func (a *ArtistRequest) Do() error {
 	return nil
 }
 
-func (a *ArtistRequest) Prepare() ([]*provider.MP3, error) {
+func (a *ArtistRequest) Prepare(ctx context.Context) ([]*provider.MP3, error) {
 	savePath := filepath.Join(".", utils.TrimInvalidFilePathChars(a.SingerName))
-	return prepare(a.Response.Data.Info, savePath)
+	return prepare(ctx, a.Response.Data.Info, savePath)
 }
 
 func NewAlbumRequest(albumId string) *AlbumRequest {
@@ -277,7 +318,7 @@ func (a *AlbumRequest) Login() error {
 	panic("implement me")
 }
 
-func (a *AlbumRequest) Do() error {
+func (a *AlbumRequest) Do(ctx context.Context) error {
 	var data struct {
 		Data   Album  `json:"data"`
 		Status int    `json:"status"`
@@ -285,7 +326,7 @@ func (a *AlbumRequest) Do() error {
 	}
 
 	easylog.Debug("AlbumRequest: send GetAlbumInfo api request")
-	err := request(GetAlbumInfo,
+	err := request(ctx, GetAlbumInfo,
 		sreq.WithQuery(sreq.Params{
 			"albumid": a.AlbumId,
 		}),
@@ -304,9 +345,10 @@ func (a *AlbumRequest) Do() error {
 	}
 
 	a.AlbumName = data.Data.AlbumName
+	a.Album = data.Data
 
 	easylog.Debug("AlbumRequest: send GetAlbumSongs api request")
-	err = request(GetAlbumSongs,
+	err = request(ctx, GetAlbumSongs,
 		sreq.WithQuery(a.Params),
 		sreq.WithHeaders(sreq.Headers{
 			"Origin":  "http://mobilecdn.kugou.com",
@@ -329,9 +371,28 @@ func (a *AlbumRequest) Do() error {
 	return nil
 }
 
-func (a *AlbumRequest) Prepare() ([]*provider.MP3, error) {
+func (a *AlbumRequest) Prepare(ctx context.Context) ([]*provider.MP3, error) {
 	savePath := filepath.Join(".", utils.TrimInvalidFilePathChars(a.AlbumName))
-	return prepare(a.Response.Data.Info, savePath)
+	for _, i := range a.Response.Data.Info {
+		i.ImgURL = a.Album.ImgURL
+	}
+	mp3List, err := prepare(ctx, a.Response.Data.Info, savePath)
+	if err != nil {
+		return nil, err
+	}
+
+	releaseDate, _ := time.Parse("2006-01-02", strings.SplitN(a.Album.PublishTime, " ", 2)[0])
+	for i, m := range mp3List {
+		m.Track.Album = strings.TrimSpace(a.AlbumName)
+		m.Track.AlbumArtist = strings.TrimSpace(a.Album.SingerName)
+		m.Track.TrackNumber = i + 1
+		m.Track.ReleaseDate = releaseDate
+	}
+	return mp3List, nil
+}
+
+func (a *AlbumRequest) CollectionName() string {
+	return strings.TrimSpace(a.AlbumName)
 }
 
 func NewPlaylistRequest(specialId string) *PlaylistRequest {
@@ -352,7 +413,7 @@ func (p *PlaylistRequest) Login() error {
 	panic("implement me")
 }
 
-func (p *PlaylistRequest) Do() error {
+func (p *PlaylistRequest) Do(ctx context.Context) error {
 	var data struct {
 		Data   Playlist `json:"data"`
 		Status int      `json:"status"`
@@ -360,7 +421,7 @@ func (p *PlaylistRequest) Do() error {
 	}
 
 	easylog.Debug("PlaylistRequest: send GetPlaylistInfo api request")
-	err := request(GetPlaylistInfo,
+	err := request(ctx, GetPlaylistInfo,
 		sreq.WithQuery(sreq.Params{
 			"specialid": p.SpecialId,
 		}),
@@ -381,7 +442,7 @@ func (p *PlaylistRequest) Do() error {
 	p.SpecialName = data.Data.SpecialName
 
 	easylog.Debug("PlaylistRequest: send GetPlaylistSongs api request")
-	err = request(GetPlaylistSongs,
+	err = request(ctx, GetPlaylistSongs,
 		sreq.WithQuery(p.Params),
 	).JSON(&p.Response)
 	if err != nil {
@@ -400,13 +461,100 @@ func (p *PlaylistRequest) Do() error {
 	return nil
 }
 
-func (p *PlaylistRequest) Prepare() ([]*provider.MP3, error) {
+func (p *PlaylistRequest) Prepare(ctx context.Context) ([]*provider.MP3, error) {
 	savePath := filepath.Join(".", utils.TrimInvalidFilePathChars(p.SpecialName))
-	return prepare(p.Response.Data.Info, savePath)
+	return prepare(ctx, p.Response.Data.Info, savePath)
+}
+
+func (p *PlaylistRequest) CollectionName() string {
+	return strings.TrimSpace(p.SpecialName)
+}
+
+func NewLyricsRequest(hash string, duration int64) *LyricsRequest {
+	params := sreq.Params{
+		"hash":     hash,
+		"duration": strconv.FormatInt(duration, 10),
+		"keyword":  "",
+	}
+	return &LyricsRequest{Params: params}
 }
 
-func request(url string, opts ...sreq.RequestOption) *sreq.Response {
-	return provider.Client(provider.KugouMusic).
-		Get(url, opts...).
-		EnsureStatusOk()
+func (l *LyricsRequest) Do(ctx context.Context) error {
+	var data struct {
+		Status     int    `json:"status"`
+		ErrMsg     string `json:"errmsg"`
+		Candidates []struct {
+			Id        string `json:"id"`
+			AccessKey string `json:"accesskey"`
+		} `json:"candidates"`
+	}
+
+	easylog.Debug("LyricsRequest: send SearchLyrics api request")
+	err := request(ctx, SearchLyrics,
+		sreq.WithQuery(l.Params),
+	).JSON(&data)
+	if err != nil {
+		return fmt.Errorf("LyricsRequest: SearchLyrics api request error: %w", err)
+	}
+
+	if data.Status != http.StatusOK {
+		return fmt.Errorf("LyricsRequest: SearchLyrics api status error: %d: %s",
+			data.Status, data.ErrMsg)
+	}
+
+	if len(data.Candidates) == 0 {
+		return errors.New("LyricsRequest: lyrics unavailable")
+	}
+
+	easylog.Debug("LyricsRequest: send GetLyrics api request")
+	err = request(ctx, GetLyrics,
+		sreq.WithQuery(sreq.Params{
+			"id":        data.Candidates[0].Id,
+			"accesskey": data.Candidates[0].AccessKey,
+		}),
+	).JSON(&l.Response)
+	if err != nil {
+		return fmt.Errorf("LyricsRequest: GetLyrics api request error: %w", err)
+	}
+
+	if l.Response.Status != http.StatusOK {
+		return fmt.Errorf("LyricsRequest: GetLyrics api status error: %d: %s",
+			l.Response.Status, l.Response.Info)
+	}
+
+	return nil
+}
+
+func NewSearchRequest(keyword string, limit int) *SearchRequest {
+	params := sreq.Params{
+		"keyword":  keyword,
+		"pagesize": strconv.Itoa(limit),
+	}
+	return &SearchRequest{Params: params}
+}
+
+func (s *SearchRequest) Do(ctx context.Context) error {
+	easylog.Debug("SearchRequest: send Search api request")
+	err := request(ctx, Search,
+		sreq.WithQuery(s.Params),
+	).JSON(&s.Response)
+	if err != nil {
+		return fmt.Errorf("SearchRequest: Search api request error: %w", err)
+	}
+
+	if s.Response.Status != 1 {
+		return fmt.Errorf("SearchRequest: Search api status error: %d: %s",
+			s.Response.Status, s.Response.Error)
+	}
+
+	return nil
+}
+
+func request(ctx context.Context, url string, opts ...sreq.RequestOption) *sreq.Response {
+	return provider.Retry(ctx, func() *sreq.Response {
+		if err := provider.WaitRateLimit(ctx, provider.KugouMusic, url); err != nil {
+			return &sreq.Response{Err: err}
+		}
+		return provider.Client(provider.KugouMusic).Get(url, append(opts, sreq.WithContext(ctx))...)
+	}).EnsureStatusOk()
 }
@@ -0,0 +1,27 @@
+package kugou
+
+import (
+	"context"
+	"encoding/base64"
+
+	"github.com/winterssy/music-get/pkg/lrc"
+	"github.com/winterssy/music-get/provider"
+)
+
+func init() {
+	provider.RegisterLyricsFunc(provider.KugouMusic, fetchLyrics)
+}
+
+func fetchLyrics(ctx context.Context, track *provider.Track) (*lrc.Lyrics, error) {
+	req := NewLyricsRequest(track.Id, track.Duration.Milliseconds())
+	if err := req.Do(ctx); err != nil {
+		return nil, err
+	}
+
+	// content is base64 encoded
+	content, err := base64.StdEncoding.DecodeString(req.Response.Content)
+	if err != nil {
+		return nil, err
+	}
+	return lrc.Parse(string(content)), nil
+}
@@ -2,16 +2,35 @@ package kugou
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/winterssy/music-get/conf"
 	"github.com/winterssy/music-get/provider"
 	"github.com/winterssy/music-get/utils"
 )
 
 type (
 	Song struct {
-		FileName string `json:"filename"`
-		ExtName  string `json:"extname"`
-		Hash     string `json:"hash"`
+		FileName   string `json:"filename"`
+		ExtName    string `json:"extname"`
+		Hash       string `json:"hash"`
+		HQHash     string `json:"320hash"`
+		SQHash     string `json:"sqhash"`
+		Duration   int    `json:"duration"`
+		BitRate    int    `json:"bitrate"`
+		AlbumId    string `json:"album_id"`
+		SongName   string `json:"-"`
+		SingerName string `json:"-"`
+		ImgURL     string `json:"-"`
+	}
+
+	// SearchSong is a song in the search results.
+	SearchSong struct {
+		Song
+		SongName   string `json:"songname"`
+		SingerName string `json:"singername"`
+		AlbumName  string `json:"album_name"`
 	}
 
 	Artist struct {
@@ -20,8 +39,11 @@ type (
 	}
 
 	Album struct {
-		AlbumId   int    `json:"albumid"`
-		AlbumName string `json:"albumname"`
+		AlbumId     int    `json:"albumid"`
+		AlbumName   string `json:"albumname"`
+		SingerName  string `json:"singername"`
+		PublishTime string `json:"publishtime"`
+		ImgURL      string `json:"imgurl"`
 	}
 
 	Playlist struct {
@@ -32,9 +54,51 @@ type (
 
 func (s *Song) resolve() *provider.MP3 {
 	fileName := utils.TrimInvalidFilePathChars(fmt.Sprintf("%s.%s", s.FileName, s.ExtName))
+
+	title, singerName := strings.TrimSpace(s.SongName), s.SingerName
+	if title == "" {
+		// filename is formatted as "artists - title"
+		title = strings.TrimSpace(s.FileName)
+		if i := strings.Index(s.FileName, " - "); i > 0 {
+			title, singerName = strings.TrimSpace(s.FileName[i+3:]), s.FileName[:i]
+		}
+	}
+
+	artists := make([]string, 0)
+	for _, ar := range strings.Split(singerName, "、") {
+		if ar = strings.TrimSpace(ar); ar != "" {
+			artists = append(artists, ar)
+		}
+	}
+
 	return &provider.MP3{
 		FileName: fileName,
 		Playable: true,
 		Provider: provider.KugouMusic,
+		Track: &provider.Track{
+			Id:       s.Hash,
+			Title:    title,
+			Artists:  artists,
+			Duration: time.Duration(s.Duration) * time.Second,
+			CoverURL: imgURL(s.ImgURL),
+			BitRate:  s.BitRate,
+		},
+	}
+}
+
+// hash returns the file hash of the quality, empty if unavailable.
+func (s *Song) hash(quality int) string {
+	switch quality {
+	case conf.QualityLossless:
+		return s.SQHash
+	case conf.QualityHigh:
+		return s.HQHash
+	default:
+		return s.Hash
 	}
 }
+
+// imgURL replaces the size placeholder of kugou image url.
+func imgURL(url string) string {
+	return strings.ReplaceAll(url, "{size}", "480")
+}
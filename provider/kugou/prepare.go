@@ -1,12 +1,14 @@
 package kugou
 
 import (
+	"context"
+
 	"github.com/winterssy/easylog"
 	"github.com/winterssy/music-get/pkg/concurrency"
 	"github.com/winterssy/music-get/provider"
 )
 
-func prepare(songs []*Song, savePath string) ([]*provider.MP3, error) {
+func prepare(ctx context.Context, songs []*Song, savePath string) ([]*provider.MP3, error) {
 	mp3List := make([]*provider.MP3, len(songs))
 	c := concurrency.New(16)
 	for i, s := range songs {
@@ -15,13 +17,23 @@ func prepare(songs []*Song, savePath string) ([]*provider.MP3, error) {
 			defer c.Done()
 			mp3 := song.resolve()
 			mp3.SavePath = savePath
-			req := NewSongURLRequest(song.Hash)
-			if err := req.Do(); err != nil {
-				mp3.Playable = false
+			resp, err := songURL(song, func(hash string) (*SongURLResponse, error) {
+				req := NewSongURLRequest(hash)
+				if err := req.Do(ctx); err != nil {
+					return nil, err
+				}
+				return &req.Response, nil
+			})
+			mp3.Playable = resp != nil
+			if resp != nil {
+				mp3.DownloadURL = resp.URL[0]
+				if br := resp.BitRate; br > 0 {
+					// bitRate is reported in bps
+					mp3.Track.BitRate = br / 1000
+				}
+				mp3.SetExt(resp.ExtName)
+			} else if err != nil {
 				easylog.Errorf("Get song download url failed: %s: %s", song.Hash, err.Error())
-			} else {
-				mp3.Playable = req.Response.Status == 1
-				mp3.DownloadURL = req.Response.URL[0]
 			}
 			mp3List[i] = mp3
 		}(i, s)
@@ -29,3 +41,23 @@ func prepare(songs []*Song, savePath string) ([]*provider.MP3, error) {
 	c.Wait()
 	return mp3List, nil
 }
+
+// songURL requests the song url from the configured quality down and returns the first playable one,
+// nil with the error of the last request if none is playable.
+func songURL(song *Song, fetch func(hash string) (*SongURLResponse, error)) (resp *SongURLResponse, err error) {
+	for _, q := range provider.Qualities() {
+		hash := song.hash(q)
+		if hash == "" {
+			continue
+		}
+		if resp, err = fetch(hash); err != nil {
+			easylog.Debugf("Song url unavailable: %s: %s", hash, err.Error())
+			continue
+		}
+		if resp.Status == 1 && len(resp.URL) > 0 && resp.URL[0] != "" {
+			return resp, nil
+		}
+		easylog.Debugf("Song url unavailable: %s: status %d", hash, resp.Status)
+	}
+	return nil, err
+}
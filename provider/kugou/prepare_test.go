@@ -0,0 +1,87 @@
+package kugou
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/winterssy/music-get/conf"
+)
+
+func TestSongURL(t *testing.T) {
+	conf.Conf.Quality = conf.QualityLossless
+	defer func() {
+		conf.Conf.Quality = conf.QualityStandard
+	}()
+	song := &Song{Hash: "pq", HQHash: "hq", SQHash: "sq"}
+
+	tests := []struct {
+		name      string
+		responses map[string]*SongURLResponse
+		requested []string
+		want      string
+		err       bool
+	}{
+		{
+			name: "lossless available",
+			responses: map[string]*SongURLResponse{
+				"sq": {Status: 1, URL: []string{"http://a/sq.flac"}},
+			},
+			requested: []string{"sq"},
+			want:      "http://a/sq.flac",
+		},
+		{
+			name: "step down over unplayable and empty replies",
+			responses: map[string]*SongURLResponse{
+				"sq": {Status: 0},
+				"hq": {Status: 1},
+				"pq": {Status: 1, URL: []string{"http://a/pq.mp3"}},
+			},
+			requested: []string{"sq", "hq", "pq"},
+			want:      "http://a/pq.mp3",
+		},
+		{
+			name: "step down over errors",
+			responses: map[string]*SongURLResponse{
+				"hq": {Status: 1, URL: []string{"http://a/hq.mp3"}},
+			},
+			requested: []string{"sq", "hq"},
+			want:      "http://a/hq.mp3",
+		},
+		{
+			name:      "none available",
+			requested: []string{"sq", "hq", "pq"},
+			err:       true,
+		},
+	}
+	for _, test := range tests {
+		var requested []string
+		resp, err := songURL(song, func(hash string) (*SongURLResponse, error) {
+			requested = append(requested, hash)
+			if resp, ok := test.responses[hash]; ok {
+				return resp, nil
+			}
+			return nil, errors.New("request failed")
+		})
+		if !reflect.DeepEqual(requested, test.requested) {
+			t.Errorf("%s: requested %v, want %v", test.name, requested, test.requested)
+		}
+		if test.want == "" {
+			if resp != nil || (err != nil) != test.err {
+				t.Errorf("%s: got %+v, %v", test.name, resp, err)
+			}
+		} else if resp == nil || resp.URL[0] != test.want {
+			t.Errorf("%s: got %+v, %v, want %s", test.name, resp, err, test.want)
+		}
+	}
+
+	// the hashes of unavailable qualities are skipped
+	var requested []string
+	songURL(&Song{Hash: "pq"}, func(hash string) (*SongURLResponse, error) {
+		requested = append(requested, hash)
+		return &SongURLResponse{Status: 1, URL: []string{"http://a/pq.mp3"}}, nil
+	})
+	if !reflect.DeepEqual(requested, []string{"pq"}) {
+		t.Errorf("songURL requested %v, want [pq]", requested)
+	}
+}
@@ -0,0 +1,38 @@
+package kugou
+
+import (
+	"context"
+	"strings"
+
+	"github.com/winterssy/music-get/provider"
+)
+
+func init() {
+	provider.RegisterSearchFunc(provider.KugouMusic, search)
+	provider.RegisterSongRequestFunc(provider.KugouMusic, newSongRequest)
+}
+
+func search(ctx context.Context, keyword string, limit int) ([]*provider.SearchResult, error) {
+	req := NewSearchRequest(keyword, limit)
+	if err := req.Do(ctx); err != nil {
+		return nil, err
+	}
+
+	results := make([]*provider.SearchResult, 0, len(req.Response.Data.Info))
+	for _, i := range req.Response.Data.Info {
+		song := i.Song
+		song.SongName, song.SingerName = i.SongName, i.SingerName
+		track := song.resolve().Track
+		track.Album = strings.TrimSpace(i.AlbumName)
+		results = append(results, &provider.SearchResult{
+			Track:    track,
+			Provider: provider.KugouMusic,
+			Request:  NewSongRequest(i.Hash),
+		})
+	}
+	return results, nil
+}
+
+func newSongRequest(hash string) (provider.MusicRequest, error) {
+	return NewSongRequest(hash), nil
+}
@@ -1,27 +1,48 @@
 package kuwo
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/winterssy/easylog"
+	"github.com/winterssy/music-get/conf"
 	"github.com/winterssy/music-get/provider"
 	"github.com/winterssy/music-get/utils"
 	"github.com/winterssy/sreq"
 )
 
 const (
-	GetSongURL     = "http://www.kuwo.cn/url?format=mp3&response=url&type=convert_url3&br=128kmp3"
+	GetSongURL     = "http://www.kuwo.cn/url?response=url&type=convert_url3"
 	GetSong        = "http://www.kuwo.cn/api/www/music/musicInfo"
 	GetArtistInfo  = "http://www.kuwo.cn/api/www/artist/artist"
 	GetArtistSongs = "http://www.kuwo.cn/api/www/artist/artistMusic?pn=1&rn=50"
 	GetAlbum       = "http://www.kuwo.cn/api/www/album/albumInfo?pn=1&rn=9999"
 	GetPlaylist    = "http://www.kuwo.cn/api/www/playlist/playListInfo?pn=1&rn=9999"
+	GetLyrics      = "http://m.kuwo.cn/newh5/singles/songinfoandlrc"
+	Search         = "http://www.kuwo.cn/api/www/search/searchMusicBykeyWord?pn=1"
+)
+
+var (
+	// bitRates maps the qualities to kuwo br parameters
+	bitRates = map[int]bitRate{
+		conf.QualityStandard: {"128kmp3", "mp3", 128},
+		conf.QualityHigh:     {"320kmp3", "mp3", 320},
+		conf.QualityLossless: {"2000kflac", "flac", 0},
+	}
 )
 
 type (
+	bitRate struct {
+		br     string
+		format string
+		kbps   int
+	}
+
 	SongURLResponse struct {
 		Code int    `json:"code"`
 		Msg  string `json:"msg"`
@@ -65,6 +86,7 @@ type (
 		Data struct {
 			AlbumId   int     `json:"albumId"`
 			Album     string  `json:"album"`
+			Artist    string  `json:"artist"`
 			MusicList []*Song `json:"musicList"`
 		} `json:"data"`
 	}
@@ -88,18 +110,50 @@ type (
 		Params   sreq.Params
 		Response PlaylistResponse
 	}
+
+	LyricsResponse struct {
+		Status int    `json:"status"`
+		Msg    string `json:"msg"`
+		Data   struct {
+			LrcList []struct {
+				LineLyric string `json:"lineLyric"`
+				Time      string `json:"time"`
+			} `json:"lrclist"`
+		} `json:"data"`
+	}
+
+	LyricsRequest struct {
+		Params   sreq.Params
+		Response LyricsResponse
+	}
+
+	SearchResponse struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+		Data struct {
+			Total string  `json:"total"`
+			List  []*Song `json:"list"`
+		} `json:"data"`
+	}
+
+	SearchRequest struct {
+		Params   sreq.Params
+		Response SearchResponse
+	}
 )
 
-func NewSongURLRequest(rid string) *SongURLRequest {
+func NewSongURLRequest(rid, br, format string) *SongURLRequest {
 	params := sreq.Params{
-		"rid": rid,
+		"rid":    rid,
+		"br":     br,
+		"format": format,
 	}
 	return &SongURLRequest{Params: params}
 }
 
-func (s *SongURLRequest) Do() error {
+func (s *SongURLRequest) Do(ctx context.Context) error {
 	easylog.Debug("SongURLRequest: send GetSongURL api request")
-	err := request(GetSongURL,
+	err := request(ctx, GetSongURL,
 		sreq.WithQuery(s.Params),
 	).JSON(&s.Response)
 	if err != nil {
@@ -133,9 +187,9 @@ func (s *SongRequest) Login() error {
 	panic("implement me")
 }
 
-func (s *SongRequest) Do() error {
+func (s *SongRequest) Do(ctx context.Context) error {
 	easylog.Debug("SongRequest: send GetSong api request")
-	err := request(GetSong,
+	err := request(ctx, GetSong,
 		sreq.WithQuery(s.Params),
 	).JSON(&s.Response)
 	if err != nil {
@@ -150,11 +204,11 @@ func (s *SongRequest) Do() error {
 	return nil
 }
 
-func (s *SongRequest) Prepare() ([]*provider.MP3, error) {
+func (s *SongRequest) Prepare(ctx context.Context) ([]*provider.MP3, error) {
 	songs := []*Song{
 		s.Response.Data,
 	}
-	return prepare(songs, ".")
+	return prepare(ctx, songs, ".")
 }
 
 func NewArtistRequest(artistId string) *ArtistRequest {
@@ -175,7 +229,7 @@ func (a *ArtistRequest) Login() error {
 	panic("implement me")
 }
 
-func (a *ArtistRequest) Do() error {
+func (a *ArtistRequest) Do(ctx context.Context) error {
 	var data struct {
 		Code int    `json:"code"`
 		Msg  string `json:"msg"`
@@ -183,7 +237,7 @@ func (a *ArtistRequest) Do() error {
 	}
 
 	easylog.Debug("ArtistRequest: send GetArtistInfo api request")
-	err := request(GetArtistInfo,
+	err := request(ctx, GetArtistInfo,
 		sreq.WithQuery(sreq.Params{
 			"artistid": a.artistId,
 		}),
@@ -200,7 +254,7 @@ func (a *ArtistRequest) Do() error {
 	a.artistName = data.Data.Name
 
 	easylog.Debug("ArtistRequest: send GetArtistSongs api request")
-	err = request(GetArtistSongs,
+	err = request(ctx, GetArtistSongs,
 		sreq.WithQuery(a.Params),
 	).JSON(&a.Response)
 	if err != nil {
@@ -219,9 +273,9 @@ func (a *ArtistRequest) Do() error {
 	return nil
 }
 
-func (a *ArtistRequest) Prepare() ([]*provider.MP3, error) {
+func (a *ArtistRequest) Prepare(ctx context.Context) ([]*provider.MP3, error) {
 	savePath := filepath.Join(".", utils.TrimInvalidFilePathChars(a.artistName))
-	return prepare(a.Response.Data.List, savePath)
+	return prepare(ctx, a.Response.Data.List, savePath)
 }
 
 func NewAlbumRequest(albumId string) *AlbumRequest {
@@ -241,9 +295,9 @@ func (a *AlbumRequest) Login() error {
 	panic("implement me")
 }
 
-func (a *AlbumRequest) Do() error {
+func (a *AlbumRequest) Do(ctx context.Context) error {
 	easylog.Debug("AlbumRequest: send GetAlbum api request")
-	err := request(GetAlbum,
+	err := request(ctx, GetAlbum,
 		sreq.WithQuery(a.Params),
 	).JSON(&a.Response)
 	if err != nil {
@@ -262,9 +316,21 @@ func (a *AlbumRequest) Do() error {
 	return nil
 }
 
-func (a *AlbumRequest) Prepare() ([]*provider.MP3, error) {
+func (a *AlbumRequest) Prepare(ctx context.Context) ([]*provider.MP3, error) {
 	savePath := filepath.Join(".", utils.TrimInvalidFilePathChars(a.Response.Data.Album))
-	return prepare(a.Response.Data.MusicList, savePath)
+	mp3List, err := prepare(ctx, a.Response.Data.MusicList, savePath)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, i := range mp3List {
+		i.Track.AlbumArtist = strings.TrimSpace(a.Response.Data.Artist)
+	}
+	return mp3List, nil
+}
+
+func (a *AlbumRequest) CollectionName() string {
+	return strings.TrimSpace(a.Response.Data.Album)
 }
 
 func NewPlaylistRequest(pid string) *PlaylistRequest {
@@ -284,9 +350,9 @@ func (p *PlaylistRequest) Login() error {
 	panic("implement me")
 }
 
-func (p *PlaylistRequest) Do() error {
+func (p *PlaylistRequest) Do(ctx context.Context) error {
 	easylog.Debug("PlaylistRequest: send GetPlaylist api request")
-	err := request(GetPlaylist,
+	err := request(ctx, GetPlaylist,
 		sreq.WithQuery(p.Params),
 	).JSON(&p.Response)
 	if err != nil {
@@ -305,13 +371,69 @@ func (p *PlaylistRequest) Do() error {
 	return nil
 }
 
-func (p *PlaylistRequest) Prepare() ([]*provider.MP3, error) {
+func (p *PlaylistRequest) Prepare(ctx context.Context) ([]*provider.MP3, error) {
 	savePath := filepath.Join(".", utils.TrimInvalidFilePathChars(p.Response.Data.Name))
-	return prepare(p.Response.Data.MusicList, savePath)
+	return prepare(ctx, p.Response.Data.MusicList, savePath)
+}
+
+func (p *PlaylistRequest) CollectionName() string {
+	return strings.TrimSpace(p.Response.Data.Name)
+}
+
+func NewLyricsRequest(rid string) *LyricsRequest {
+	params := sreq.Params{
+		"musicId": rid,
+	}
+	return &LyricsRequest{Params: params}
+}
+
+func (l *LyricsRequest) Do(ctx context.Context) error {
+	easylog.Debug("LyricsRequest: send GetLyrics api request")
+	err := request(ctx, GetLyrics,
+		sreq.WithQuery(l.Params),
+	).JSON(&l.Response)
+	if err != nil {
+		return fmt.Errorf("LyricsRequest: GetLyrics api request error: %w", err)
+	}
+
+	if l.Response.Status != http.StatusOK {
+		return fmt.Errorf("LyricsRequest: GetLyrics api status error: %d: %s",
+			l.Response.Status, l.Response.Msg)
+	}
+
+	return nil
+}
+
+func NewSearchRequest(keyword string, limit int) *SearchRequest {
+	params := sreq.Params{
+		"key": keyword,
+		"rn":  strconv.Itoa(limit),
+	}
+	return &SearchRequest{Params: params}
+}
+
+func (s *SearchRequest) Do(ctx context.Context) error {
+	easylog.Debug("SearchRequest: send Search api request")
+	err := request(ctx, Search,
+		sreq.WithQuery(s.Params),
+	).JSON(&s.Response)
+	if err != nil {
+		return fmt.Errorf("SearchRequest: Search api request error: %w", err)
+	}
+
+	if s.Response.Code != http.StatusOK {
+		return fmt.Errorf("SearchRequest: Search api status error: %d: %s",
+			s.Response.Code, s.Response.Msg)
+	}
+
+	return nil
 }
 
-func request(url string, opts ...sreq.RequestOption) *sreq.Response {
-	return provider.Client(provider.KuwoMusic).
-		Get(url, opts...).
-		EnsureStatusOk()
+func request(ctx context.Context, url string, opts ...sreq.RequestOption) *sreq.Response {
+	return provider.Retry(ctx, func() *sreq.Response {
+		if err := provider.WaitRateLimit(ctx, provider.KuwoMusic, url); err != nil {
+			return &sreq.Response{Err: err}
+		}
+		return provider.Client(provider.KuwoMusic).Get(url, append(opts, sreq.WithContext(ctx))...)
+	}).EnsureStatusOk()
 }
@@ -0,0 +1,36 @@
+package kuwo
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/winterssy/music-get/pkg/lrc"
+	"github.com/winterssy/music-get/provider"
+)
+
+func init() {
+	provider.RegisterLyricsFunc(provider.KuwoMusic, fetchLyrics)
+}
+
+func fetchLyrics(ctx context.Context, track *provider.Track) (*lrc.Lyrics, error) {
+	req := NewLyricsRequest(track.Id)
+	if err := req.Do(ctx); err != nil {
+		return nil, err
+	}
+
+	// lrclist is already split into lines, time is formatted as seconds, such as 12.34
+	lyrics := &lrc.Lyrics{}
+	for _, i := range req.Response.Data.LrcList {
+		sec, err := strconv.ParseFloat(i.Time, 64)
+		if err != nil {
+			continue
+		}
+		lyrics.Lines = append(lyrics.Lines, &lrc.Line{
+			Time: time.Duration(sec * float64(time.Second)).Round(time.Millisecond),
+			Text: strings.TrimSpace(i.LineLyric),
+		})
+	}
+	return lyrics, nil
+}
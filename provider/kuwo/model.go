@@ -2,6 +2,9 @@ package kuwo
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/winterssy/music-get/provider"
 	"github.com/winterssy/music-get/utils"
@@ -13,6 +16,11 @@ type (
 		RId         int    `json:"rid"`
 		Name        string `json:"name"`
 		Artist      string `json:"artist"`
+		Album       string `json:"album"`
+		AlbumPic    string `json:"albumpic"`
+		Track       int    `json:"track"`
+		Duration    int    `json:"duration"`
+		ReleaseDate string `json:"releaseDate"`
 		IsListenFee bool   `json:"isListenFee"`
 	}
 
@@ -24,9 +32,28 @@ type (
 
 func (s *Song) resolve() *provider.MP3 {
 	fileName := utils.TrimInvalidFilePathChars(fmt.Sprintf("%s - %s.mp3", s.Artist, s.Name))
+
+	artists := make([]string, 0)
+	for _, ar := range strings.Split(s.Artist, "&") {
+		if ar = strings.TrimSpace(ar); ar != "" {
+			artists = append(artists, ar)
+		}
+	}
+
+	releaseDate, _ := time.Parse("2006-01-02", s.ReleaseDate)
 	return &provider.MP3{
 		FileName: fileName,
 		Playable: true,
 		Provider: provider.KuwoMusic,
+		Track: &provider.Track{
+			Id:          strconv.Itoa(s.RId),
+			Title:       strings.TrimSpace(s.Name),
+			Artists:     artists,
+			Album:       strings.TrimSpace(s.Album),
+			TrackNumber: s.Track,
+			ReleaseDate: releaseDate,
+			Duration:    time.Duration(s.Duration) * time.Second,
+			CoverURL:    s.AlbumPic,
+		},
 	}
 }
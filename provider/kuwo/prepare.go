@@ -1,6 +1,7 @@
 package kuwo
 
 import (
+	"context"
 	"net/http"
 	"strconv"
 
@@ -9,7 +10,7 @@ import (
 	"github.com/winterssy/music-get/provider"
 )
 
-func prepare(songs []*Song, savePath string) ([]*provider.MP3, error) {
+func prepare(ctx context.Context, songs []*Song, savePath string) ([]*provider.MP3, error) {
 	mp3List := make([]*provider.MP3, len(songs))
 	c := concurrency.New(16)
 	for i, s := range songs {
@@ -18,13 +19,24 @@ func prepare(songs []*Song, savePath string) ([]*provider.MP3, error) {
 			defer c.Done()
 			mp3 := song.resolve()
 			mp3.SavePath = savePath
-			req := NewSongURLRequest(strconv.Itoa(song.RId))
-			if err := req.Do(); err != nil {
-				mp3.Playable = false
+			resp, br, err := songURL(song, func(br bitRate) (*SongURLResponse, error) {
+				req := NewSongURLRequest(strconv.Itoa(song.RId), br.br, br.format)
+				if err := req.Do(ctx); err != nil {
+					return nil, err
+				}
+				return &req.Response, nil
+			})
+			mp3.Playable = resp != nil
+			if resp != nil {
+				mp3.DownloadURL = resp.URL
+				mp3.Track.BitRate = br.kbps
+				if ext := provider.ExtFromURL(resp.URL); ext != "" {
+					mp3.SetExt(ext)
+				} else {
+					mp3.SetExt(br.format)
+				}
+			} else if err != nil {
 				easylog.Errorf("Get song download url failed: %d: %s", song.RId, err.Error())
-			} else {
-				mp3.Playable = req.Response.Code == http.StatusOK
-				mp3.DownloadURL = req.Response.URL
 			}
 			mp3List[i] = mp3
 		}(i, s)
@@ -32,3 +44,20 @@ func prepare(songs []*Song, savePath string) ([]*provider.MP3, error) {
 	c.Wait()
 	return mp3List, nil
 }
+
+// songURL requests the song url from the configured quality down and returns the first playable one
+// with its bit rate, nil with the error of the last request if none is playable.
+func songURL(song *Song, fetch func(br bitRate) (*SongURLResponse, error)) (resp *SongURLResponse, br bitRate, err error) {
+	for _, q := range provider.Qualities() {
+		br = bitRates[q]
+		if resp, err = fetch(br); err != nil {
+			easylog.Debugf("Song url of br %s unavailable: %d: %s", br.br, song.RId, err.Error())
+			continue
+		}
+		if resp.Code == http.StatusOK && resp.URL != "" {
+			return resp, br, nil
+		}
+		easylog.Debugf("Song url of br %s unavailable: %d: code %d", br.br, song.RId, resp.Code)
+	}
+	return nil, bitRate{}, err
+}
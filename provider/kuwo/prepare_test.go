@@ -0,0 +1,79 @@
+package kuwo
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/winterssy/music-get/conf"
+)
+
+func TestSongURL(t *testing.T) {
+	conf.Conf.Quality = conf.QualityLossless
+	defer func() {
+		conf.Conf.Quality = conf.QualityStandard
+	}()
+	song := &Song{RId: 1}
+
+	tests := []struct {
+		name      string
+		responses map[string]*SongURLResponse
+		requested []string
+		want      string
+		kbps      int
+	}{
+		{
+			name: "lossless available",
+			responses: map[string]*SongURLResponse{
+				"2000kflac": {Code: http.StatusOK, URL: "http://a/1.flac"},
+			},
+			requested: []string{"2000kflac"},
+			want:      "http://a/1.flac",
+		},
+		{
+			name: "step down over unplayable and empty replies",
+			responses: map[string]*SongURLResponse{
+				"2000kflac": {Code: http.StatusForbidden},
+				"320kmp3":   {Code: http.StatusOK},
+				"128kmp3":   {Code: http.StatusOK, URL: "http://a/1.mp3"},
+			},
+			requested: []string{"2000kflac", "320kmp3", "128kmp3"},
+			want:      "http://a/1.mp3",
+			kbps:      128,
+		},
+		{
+			name: "step down over errors",
+			responses: map[string]*SongURLResponse{
+				"320kmp3": {Code: http.StatusOK, URL: "http://a/1.mp3"},
+			},
+			requested: []string{"2000kflac", "320kmp3"},
+			want:      "http://a/1.mp3",
+			kbps:      320,
+		},
+		{
+			name:      "none available",
+			requested: []string{"2000kflac", "320kmp3", "128kmp3"},
+		},
+	}
+	for _, test := range tests {
+		var requested []string
+		resp, br, err := songURL(song, func(br bitRate) (*SongURLResponse, error) {
+			requested = append(requested, br.br)
+			if resp, ok := test.responses[br.br]; ok {
+				return resp, nil
+			}
+			return nil, errors.New("request failed")
+		})
+		if !reflect.DeepEqual(requested, test.requested) {
+			t.Errorf("%s: requested %v, want %v", test.name, requested, test.requested)
+		}
+		if test.want == "" {
+			if resp != nil || err == nil {
+				t.Errorf("%s: got %+v, %v", test.name, resp, err)
+			}
+		} else if resp == nil || resp.URL != test.want || br.kbps != test.kbps {
+			t.Errorf("%s: got %+v, %+v, %v, want %s", test.name, resp, br, err, test.want)
+		}
+	}
+}
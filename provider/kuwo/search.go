@@ -0,0 +1,34 @@
+package kuwo
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/winterssy/music-get/provider"
+)
+
+func init() {
+	provider.RegisterSearchFunc(provider.KuwoMusic, search)
+	provider.RegisterSongRequestFunc(provider.KuwoMusic, newSongRequest)
+}
+
+func search(ctx context.Context, keyword string, limit int) ([]*provider.SearchResult, error) {
+	req := NewSearchRequest(keyword, limit)
+	if err := req.Do(ctx); err != nil {
+		return nil, err
+	}
+
+	results := make([]*provider.SearchResult, 0, len(req.Response.Data.List))
+	for _, i := range req.Response.Data.List {
+		results = append(results, &provider.SearchResult{
+			Track:    i.resolve().Track,
+			Provider: provider.KuwoMusic,
+			Request:  NewSongRequest(strconv.Itoa(i.RId)),
+		})
+	}
+	return results, nil
+}
+
+func newSongRequest(rid string) (provider.MusicRequest, error) {
+	return NewSongRequest(rid), nil
+}
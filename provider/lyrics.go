@@ -0,0 +1,46 @@
+package provider
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/winterssy/easylog"
+	"github.com/winterssy/music-get/pkg/lrc"
+)
+
+type (
+	// LyricsFunc fetches the lyrics of a track from its provider.
+	LyricsFunc func(ctx context.Context, track *Track) (*lrc.Lyrics, error)
+)
+
+var (
+	lyricsFuncs = make(map[int]LyricsFunc)
+)
+
+// RegisterLyricsFunc registers the lyrics fetcher of a platform, it should be called in init.
+func RegisterLyricsFunc(platform int, f LyricsFunc) {
+	lyricsFuncs[platform] = f
+}
+
+func (m *MP3) saveLyrics(ctx context.Context, fPath string) error {
+	fetch, ok := lyricsFuncs[m.Provider]
+	if !ok || m.Track == nil {
+		easylog.Debugf("Lyrics unsupported: %s", m.FileName)
+		return nil
+	}
+
+	lyrics, err := fetch(ctx, m.Track)
+	if err != nil {
+		return err
+	}
+	if lyrics.Empty() {
+		easylog.Debugf("No lyrics: %s", m.FileName)
+		return nil
+	}
+
+	m.lyrics = lyrics
+	lrcPath := strings.TrimSuffix(fPath, filepath.Ext(fPath)) + ".lrc"
+	return ioutil.WriteFile(lrcPath, []byte(lyrics.String()), 0644)
+}
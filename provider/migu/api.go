@@ -1,27 +1,49 @@
 package migu
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/winterssy/easylog"
+	"github.com/winterssy/music-get/conf"
 	"github.com/winterssy/music-get/provider"
 	"github.com/winterssy/music-get/utils"
 	"github.com/winterssy/sreq"
 )
 
 const (
-	GetSongURL          = "https://app.c.nf.migu.cn/MIGUM2.0/v2.0/content/listen-url?netType=01&toneFlag=HQ"
+	GetSongURL          = "https://app.c.nf.migu.cn/MIGUM2.0/v2.0/content/listen-url?netType=01"
 	GetSongId           = "http://music.migu.cn/v3/api/music/audioPlayer/songs?type=1"
 	GetSong             = "https://app.c.nf.migu.cn/MIGUM2.0/v2.0/content/querySongBySongId.do?contentId=0"
 	GetArtistResource   = "https://app.c.nf.migu.cn/MIGUM2.0/v1.0/content/resourceinfo.do?needSimple=01&resourceType=2002"
 	GetAlbumResource    = "https://app.c.nf.migu.cn/MIGUM2.0/v1.0/content/resourceinfo.do?needSimple=01&resourceType=2003"
 	GetPlaylistResource = "https://app.c.nf.migu.cn/MIGUM2.0/v1.0/content/resourceinfo.do?needSimple=01&resourceType=2021"
 	GetArtistSongs      = "https://app.c.nf.migu.cn/MIGUM3.0/v1.0/template/singerSongs/release?pageNo=1&pageSize=50&templateVersion=2"
+	GetLyrics           = "http://music.migu.cn/v3/api/music/audioPlayer/getLyric"
+	Search              = "https://pd.musicapp.migu.cn/MIGUM3.0/v1.0/content/search_all.do?isCopyright=1&isCorrect=1&pageNo=1"
+)
+
+var (
+	// toneFlags are the migu tone flags of the qualities from the highest down
+	toneFlags = []toneFlag{
+		{conf.QualityLossless, "SQ", "flac", 0},
+		{conf.QualityHigh, "HQ", "mp3", 320},
+		{conf.QualityStandard, "PQ", "mp3", 128},
+	}
 )
 
 type (
+	toneFlag struct {
+		quality int
+		flag    string
+		ext     string
+		bitRate int
+	}
+
 	SongURLResponse struct {
 		Code string `json:"code"`
 		Info string `json:"info"`
@@ -86,22 +108,48 @@ type (
 		Params   sreq.Params
 		Response PlaylistResponse
 	}
+
+	LyricsResponse struct {
+		ReturnCode string `json:"returnCode"`
+		Msg        string `json:"msg"`
+		Lyric      string `json:"lyric"`
+	}
+
+	LyricsRequest struct {
+		Params   sreq.Params
+		Response LyricsResponse
+	}
+
+	SearchResponse struct {
+		Code           string `json:"code"`
+		Info           string `json:"info"`
+		SongResultData struct {
+			TotalCount string        `json:"totalCount"`
+			Result     []*SearchSong `json:"result"`
+		} `json:"songResultData"`
+	}
+
+	SearchRequest struct {
+		Params   sreq.Params
+		Response SearchResponse
+	}
 )
 
-func NewSongURLRequest(albumId, contentId, copyrightId, resourceType string) *SongURLRequest {
+func NewSongURLRequest(albumId, contentId, copyrightId, resourceType, toneFlag string) *SongURLRequest {
 	params := sreq.Params{
 		"albumId":               albumId,
 		"contentId":             contentId,
 		"copyrightId":           copyrightId,
 		"lowerQualityContentId": contentId,
 		"resourceType":          resourceType,
+		"toneFlag":              toneFlag,
 	}
 	return &SongURLRequest{Params: params}
 }
 
-func (s *SongURLRequest) Do() error {
+func (s *SongURLRequest) Do(ctx context.Context) error {
 	easylog.Debug("SongURLRequest: send GetSongURL api request")
-	err := request(GetSongURL,
+	err := request(ctx, GetSongURL,
 		sreq.WithQuery(s.Params),
 		sreq.WithHeaders(sreq.Headers{
 			"channel": "0146832",
@@ -136,7 +184,7 @@ func (s *SongRequest) Login() error {
 	panic("implement me")
 }
 
-func (s *SongRequest) Do() error {
+func (s *SongRequest) Do(ctx context.Context) error {
 	var data struct {
 		ReturnCode string `json:"returnCode"`
 		Msg        string `json:"msg"`
@@ -146,7 +194,7 @@ func (s *SongRequest) Do() error {
 	}
 
 	easylog.Debug("SongRequest: send GetSongId api request")
-	err := request(GetSongId,
+	err := request(ctx, GetSongId,
 		sreq.WithQuery(s.Params),
 		sreq.WithHeaders(sreq.Headers{
 			"Origin":  "http://music.migu.cn",
@@ -167,7 +215,7 @@ func (s *SongRequest) Do() error {
 	}
 
 	easylog.Debug("SongRequest: send GetSong api request")
-	err = request(GetSong,
+	err = request(ctx, GetSong,
 		sreq.WithQuery(sreq.Params{
 			"songId": data.Items[0].SongId,
 		}),
@@ -188,8 +236,8 @@ func (s *SongRequest) Do() error {
 	return nil
 }
 
-func (s *SongRequest) Prepare() ([]*provider.MP3, error) {
-	return prepare(s.Response.Resource, ".")
+func (s *SongRequest) Prepare(ctx context.Context) ([]*provider.MP3, error) {
+	return prepare(ctx, s.Response.Resource, ".")
 }
 
 func NewArtistRequest(singerId string) *ArtistRequest {
@@ -210,7 +258,7 @@ func (a *ArtistRequest) Login() error {
 	panic("implement me")
 }
 
-func (a *ArtistRequest) Do() error {
+func (a *ArtistRequest) Do(ctx context.Context) error {
 	var data struct {
 		Code     string   `json:"code"`
 		Info     string   `json:"info"`
@@ -218,7 +266,7 @@ func (a *ArtistRequest) Do() error {
 	}
 
 	easylog.Debug("ArtistRequest: send GetArtistResource api request")
-	err := request(GetArtistResource,
+	err := request(ctx, GetArtistResource,
 		sreq.WithQuery(sreq.Params{
 			"resourceId": a.SingerId,
 		}),
@@ -242,7 +290,7 @@ func (a *ArtistRequest) Do() error {
 	a.Singer = data.Resource[0].Singer
 
 	easylog.Debug("ArtistRequest: send GetArtistSongs api request")
-	err = request(GetArtistSongs,
+	err = request(ctx, GetArtistSongs,
 		sreq.WithQuery(a.Params),
 		sreq.WithHeaders(sreq.Headers{
 			"Origin":  "https://app.c.nf.migu.cn",
@@ -266,7 +314,7 @@ func (a *ArtistRequest) Do() error {
 	return nil
 }
 
-func (a *ArtistRequest) Prepare() ([]*provider.MP3, error) {
+func (a *ArtistRequest) Prepare(ctx context.Context) ([]*provider.MP3, error) {
 	itemList := a.Response.Data.ContentItemList[0].ItemList
 	n := len(itemList)
 	songs := make([]*Song, 0, n/2)
@@ -275,7 +323,7 @@ func (a *ArtistRequest) Prepare() ([]*provider.MP3, error) {
 	}
 
 	savePath := filepath.Join(".", utils.TrimInvalidFilePathChars(a.Singer))
-	return prepare(songs, savePath)
+	return prepare(ctx, songs, savePath)
 }
 
 func NewAlbumRequest(albumId string) *AlbumRequest {
@@ -293,9 +341,9 @@ func (a *AlbumRequest) Login() error {
 	panic("implement me")
 }
 
-func (a *AlbumRequest) Do() error {
+func (a *AlbumRequest) Do(ctx context.Context) error {
 	easylog.Debug("AlbumRequest: send GetAlbumResource api request")
-	err := request(GetAlbumResource,
+	err := request(ctx, GetAlbumResource,
 		sreq.WithQuery(a.Params),
 		sreq.WithHeaders(sreq.Headers{
 			"Origin":  "https://app.c.nf.migu.cn",
@@ -318,9 +366,16 @@ func (a *AlbumRequest) Do() error {
 	return nil
 }
 
-func (a *AlbumRequest) Prepare() ([]*provider.MP3, error) {
+func (a *AlbumRequest) Prepare(ctx context.Context) ([]*provider.MP3, error) {
 	savePath := filepath.Join(".", utils.TrimInvalidFilePathChars(a.Response.Resource[0].Title))
-	return prepare(a.Response.Resource[0].SongItems, savePath)
+	return prepare(ctx, a.Response.Resource[0].SongItems, savePath)
+}
+
+func (a *AlbumRequest) CollectionName() string {
+	if len(a.Response.Resource) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(a.Response.Resource[0].Title)
 }
 
 func NewPlaylistRequest(playlistId string) *PlaylistRequest {
@@ -338,9 +393,9 @@ func (p *PlaylistRequest) Login() error {
 	panic("implement me")
 }
 
-func (p *PlaylistRequest) Do() error {
+func (p *PlaylistRequest) Do(ctx context.Context) error {
 	easylog.Debug("PlaylistRequest: send GetPlaylistResource api request")
-	err := request(GetPlaylistResource,
+	err := request(ctx, GetPlaylistResource,
 		sreq.WithQuery(p.Params),
 		sreq.WithHeaders(sreq.Headers{
 			"Origin":  "https://app.c.nf.migu.cn",
@@ -364,13 +419,82 @@ func (p *PlaylistRequest) Do() error {
 	return nil
 }
 
-func (p *PlaylistRequest) Prepare() ([]*provider.MP3, error) {
+func (p *PlaylistRequest) Prepare(ctx context.Context) ([]*provider.MP3, error) {
 	savePath := filepath.Join(".", utils.TrimInvalidFilePathChars(p.Response.Resource[0].Title))
-	return prepare(p.Response.Resource[0].SongItems, savePath)
+	return prepare(ctx, p.Response.Resource[0].SongItems, savePath)
+}
+
+func (p *PlaylistRequest) CollectionName() string {
+	if len(p.Response.Resource) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(p.Response.Resource[0].Title)
+}
+
+func NewLyricsRequest(copyrightId string) *LyricsRequest {
+	params := sreq.Params{
+		"copyrightId": copyrightId,
+	}
+	return &LyricsRequest{Params: params}
+}
+
+func (l *LyricsRequest) Do(ctx context.Context) error {
+	easylog.Debug("LyricsRequest: send GetLyrics api request")
+	err := request(ctx, GetLyrics,
+		sreq.WithQuery(l.Params),
+		sreq.WithHeaders(sreq.Headers{
+			"Origin":  "http://music.migu.cn",
+			"Referer": "http://music.migu.cn",
+		}),
+	).JSON(&l.Response)
+	if err != nil {
+		return fmt.Errorf("LyricsRequest: GetLyrics api request error: %w", err)
+	}
+
+	if l.Response.ReturnCode != "000000" {
+		return fmt.Errorf("LyricsRequest: GetLyrics api status error: %s: %s",
+			l.Response.ReturnCode, l.Response.Msg)
+	}
+
+	return nil
+}
+
+func NewSearchRequest(keyword string, limit int) *SearchRequest {
+	params := sreq.Params{
+		"text":         keyword,
+		"pageSize":     strconv.Itoa(limit),
+		"searchSwitch": `{"song":1}`,
+	}
+	return &SearchRequest{Params: params}
+}
+
+func (s *SearchRequest) Do(ctx context.Context) error {
+	easylog.Debug("SearchRequest: send Search api request")
+	err := request(ctx, Search,
+		sreq.WithQuery(s.Params),
+		sreq.WithHeaders(sreq.Headers{
+			"channel": "0146921",
+			"Origin":  "https://app.c.nf.migu.cn",
+			"Referer": "https://app.c.nf.migu.cn",
+		}),
+	).JSON(&s.Response)
+	if err != nil {
+		return fmt.Errorf("SearchRequest: Search api request error: %w", err)
+	}
+
+	if s.Response.Code != "000000" {
+		return fmt.Errorf("SearchRequest: Search api status error: %s: %s",
+			s.Response.Code, s.Response.Info)
+	}
+
+	return nil
 }
 
-func request(url string, opts ...sreq.RequestOption) *sreq.Response {
-	return provider.Client(provider.MiguMusic).
-		Get(url, opts...).
-		EnsureStatusOk()
+func request(ctx context.Context, url string, opts ...sreq.RequestOption) *sreq.Response {
+	return provider.Retry(ctx, func() *sreq.Response {
+		if err := provider.WaitRateLimit(ctx, provider.MiguMusic, url); err != nil {
+			return &sreq.Response{Err: err}
+		}
+		return provider.Client(provider.MiguMusic).Get(url, append(opts, sreq.WithContext(ctx))...)
+	}).EnsureStatusOk()
 }
@@ -0,0 +1,20 @@
+package migu
+
+import (
+	"context"
+
+	"github.com/winterssy/music-get/pkg/lrc"
+	"github.com/winterssy/music-get/provider"
+)
+
+func init() {
+	provider.RegisterLyricsFunc(provider.MiguMusic, fetchLyrics)
+}
+
+func fetchLyrics(ctx context.Context, track *provider.Track) (*lrc.Lyrics, error) {
+	req := NewLyricsRequest(track.Id)
+	if err := req.Do(ctx); err != nil {
+		return nil, err
+	}
+	return lrc.Parse(req.Response.Lyric), nil
+}
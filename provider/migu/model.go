@@ -2,7 +2,9 @@ package migu
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/winterssy/music-get/provider"
 	"github.com/winterssy/music-get/utils"
@@ -19,6 +21,11 @@ type (
 		Singer       string `json:"singer"`
 		AlbumId      string `json:"albumId"`
 		Album        string `json:"album"`
+		AlbumImgs    []struct {
+			ImgSizeType string `json:"imgSizeType"`
+			Img         string `json:"img"`
+		} `json:"albumImgs"`
+		Length string `json:"length"`
 	}
 
 	Album struct {
@@ -35,6 +42,24 @@ type (
 		SongItems    []*Song `json:"songItems"`
 	}
 
+	// SearchSong is a song in the search results.
+	SearchSong struct {
+		Id          string `json:"id"`
+		ContentId   string `json:"contentId"`
+		CopyrightId string `json:"copyrightId"`
+		Name        string `json:"name"`
+		Singers     []struct {
+			Name string `json:"name"`
+		} `json:"singers"`
+		Albums []struct {
+			Name string `json:"name"`
+		} `json:"albums"`
+		ImgItems []struct {
+			ImgSizeType string `json:"imgSizeType"`
+			Img         string `json:"img"`
+		} `json:"imgItems"`
+	}
+
 	Artist struct {
 		ResourceType string `json:"resourceType"`
 		SingerId     string `json:"singerId"`
@@ -46,9 +71,70 @@ func (s *Song) resolve() *provider.MP3 {
 	title := strings.TrimSpace(s.SongName)
 	artist := strings.ReplaceAll(s.Singer, "|", " ")
 	fileName := utils.TrimInvalidFilePathChars(fmt.Sprintf("%s - %s.mp3", artist, title))
+
+	artists := make([]string, 0)
+	for _, ar := range strings.Split(s.Singer, "|") {
+		if ar = strings.TrimSpace(ar); ar != "" {
+			artists = append(artists, ar)
+		}
+	}
+
+	// the last one is the largest image
+	coverURL := ""
+	if n := len(s.AlbumImgs); n > 0 {
+		coverURL = s.AlbumImgs[n-1].Img
+	}
+
 	return &provider.MP3{
 		FileName: fileName,
 		Playable: true,
 		Provider: provider.MiguMusic,
+		Track: &provider.Track{
+			Id:       s.CopyrightId,
+			Title:    title,
+			Artists:  artists,
+			Album:    strings.TrimSpace(s.Album),
+			Duration: parseLength(s.Length),
+			CoverURL: coverURL,
+		},
+	}
+}
+
+// parseLength parses the song length formatted as 00:03:52.
+func parseLength(length string) time.Duration {
+	var d time.Duration
+	for _, i := range strings.Split(length, ":") {
+		n, err := strconv.Atoi(i)
+		if err != nil {
+			return 0
+		}
+		d = d*60 + time.Duration(n)
+	}
+	return d * time.Second
+}
+
+func (s *SearchSong) track() *provider.Track {
+	artists := make([]string, 0, len(s.Singers))
+	for _, ar := range s.Singers {
+		artists = append(artists, strings.TrimSpace(ar.Name))
+	}
+
+	album := ""
+	if len(s.Albums) > 0 {
+		album = strings.TrimSpace(s.Albums[0].Name)
+	}
+
+	// the last one is the largest image
+	coverURL := ""
+	if n := len(s.ImgItems); n > 0 {
+		coverURL = s.ImgItems[n-1].Img
+	}
+
+	return &provider.Track{
+		Id:       s.CopyrightId,
+		Title:    strings.TrimSpace(s.Name),
+		Artists:  artists,
+		Album:    album,
+		CoverURL: coverURL,
 	}
 }
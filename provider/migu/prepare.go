@@ -1,12 +1,15 @@
 package migu
 
 import (
+	"context"
+
 	"github.com/winterssy/easylog"
+	"github.com/winterssy/music-get/conf"
 	"github.com/winterssy/music-get/pkg/concurrency"
 	"github.com/winterssy/music-get/provider"
 )
 
-func prepare(songs []*Song, savePath string) ([]*provider.MP3, error) {
+func prepare(ctx context.Context, songs []*Song, savePath string) ([]*provider.MP3, error) {
 	mp3List := make([]*provider.MP3, len(songs))
 	c := concurrency.New(16)
 	for i, s := range songs {
@@ -15,11 +18,23 @@ func prepare(songs []*Song, savePath string) ([]*provider.MP3, error) {
 			defer c.Done()
 			mp3 := song.resolve()
 			mp3.SavePath = savePath
-			req := NewSongURLRequest(song.AlbumId, song.ContentId, song.CopyrightId, song.ResourceType)
-			if err := req.Do(); err != nil {
+			resp, tone, err := songURL(song, func(tone toneFlag) (*SongURLResponse, error) {
+				req := NewSongURLRequest(song.AlbumId, song.ContentId, song.CopyrightId, song.ResourceType, tone.flag)
+				if err := req.Do(ctx); err != nil {
+					return nil, err
+				}
+				return &req.Response, nil
+			})
+			if resp != nil {
+				mp3.DownloadURL = resp.Data.URL
+				mp3.Track.BitRate = tone.bitRate
+				if ext := provider.ExtFromURL(mp3.DownloadURL); ext != "" {
+					mp3.SetExt(ext)
+				} else {
+					mp3.SetExt(tone.ext)
+				}
+			} else if err != nil {
 				easylog.Errorf("Get song download url failed: %s: %s", song.CopyrightId, err.Error())
-			} else {
-				mp3.DownloadURL = req.Response.Data.URL
 			}
 			mp3List[i] = mp3
 		}(i, s)
@@ -27,3 +42,23 @@ func prepare(songs []*Song, savePath string) ([]*provider.MP3, error) {
 	c.Wait()
 	return mp3List, nil
 }
+
+// songURL requests the song url from the configured quality down and returns the first available one
+// with its tone flag, nil with the error of the last request if none is available. The standard quality
+// requests HQ first as migu always did, PQ is the last resort.
+func songURL(song *Song, fetch func(tone toneFlag) (*SongURLResponse, error)) (resp *SongURLResponse, tone toneFlag, err error) {
+	quality := int(conf.Conf.Quality)
+	if quality < conf.QualityHigh {
+		quality = conf.QualityHigh
+	}
+	for _, tone = range toneFlags {
+		if tone.quality > quality {
+			continue
+		}
+		if resp, err = fetch(tone); err == nil && resp.Data.URL != "" {
+			return resp, tone, nil
+		}
+		easylog.Debugf("Song url of tone %s unavailable: %s", tone.flag, song.CopyrightId)
+	}
+	return nil, toneFlag{}, err
+}
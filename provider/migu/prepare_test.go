@@ -0,0 +1,78 @@
+package migu
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/winterssy/music-get/conf"
+)
+
+func TestSongURL(t *testing.T) {
+	defer func() {
+		conf.Conf.Quality = conf.QualityStandard
+	}()
+	song := &Song{CopyrightId: "1"}
+
+	tests := []struct {
+		name      string
+		quality   conf.Quality
+		responses map[string]string
+		requested []string
+		want      string
+		bitRate   int
+	}{
+		{
+			name:      "standard requests HQ first",
+			quality:   conf.QualityStandard,
+			responses: map[string]string{"HQ": "http://a/1.mp3", "PQ": "http://a/2.mp3"},
+			requested: []string{"HQ"},
+			want:      "http://a/1.mp3",
+			bitRate:   320,
+		},
+		{
+			name:      "lossless available",
+			quality:   conf.QualityLossless,
+			responses: map[string]string{"SQ": "http://a/1.flac"},
+			requested: []string{"SQ"},
+			want:      "http://a/1.flac",
+		},
+		{
+			name:      "step down over empty urls and errors",
+			quality:   conf.QualityLossless,
+			responses: map[string]string{"SQ": "", "PQ": "http://a/1.mp3"},
+			requested: []string{"SQ", "HQ", "PQ"},
+			want:      "http://a/1.mp3",
+			bitRate:   128,
+		},
+		{
+			name:      "none available",
+			quality:   conf.QualityHigh,
+			requested: []string{"HQ", "PQ"},
+		},
+	}
+	for _, test := range tests {
+		conf.Conf.Quality = test.quality
+		var requested []string
+		resp, tone, err := songURL(song, func(tone toneFlag) (*SongURLResponse, error) {
+			requested = append(requested, tone.flag)
+			url, ok := test.responses[tone.flag]
+			if !ok {
+				return nil, errors.New("request failed")
+			}
+			resp := new(SongURLResponse)
+			resp.Data.URL = url
+			return resp, nil
+		})
+		if !reflect.DeepEqual(requested, test.requested) {
+			t.Errorf("%s: requested %v, want %v", test.name, requested, test.requested)
+		}
+		if test.want == "" {
+			if resp != nil || err == nil {
+				t.Errorf("%s: got %+v, %v", test.name, resp, err)
+			}
+		} else if resp == nil || resp.Data.URL != test.want || tone.bitRate != test.bitRate {
+			t.Errorf("%s: got %+v, %+v, %v, want %s", test.name, resp, tone, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package migu
+
+import (
+	"context"
+
+	"github.com/winterssy/music-get/provider"
+)
+
+func init() {
+	provider.RegisterSearchFunc(provider.MiguMusic, search)
+	provider.RegisterSongRequestFunc(provider.MiguMusic, newSongRequest)
+}
+
+func search(ctx context.Context, keyword string, limit int) ([]*provider.SearchResult, error) {
+	req := NewSearchRequest(keyword, limit)
+	if err := req.Do(ctx); err != nil {
+		return nil, err
+	}
+
+	results := make([]*provider.SearchResult, 0, len(req.Response.SongResultData.Result))
+	for _, i := range req.Response.SongResultData.Result {
+		results = append(results, &provider.SearchResult{
+			Track:    i.track(),
+			Provider: provider.MiguMusic,
+			Request:  NewSongRequest(i.CopyrightId),
+		})
+	}
+	return results, nil
+}
+
+func newSongRequest(copyrightId string) (provider.MusicRequest, error) {
+	return NewSongRequest(copyrightId), nil
+}
@@ -1,6 +1,7 @@
 package netease
 
 import (
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
@@ -9,6 +10,7 @@ import (
 	"net/http"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/winterssy/easylog"
 	"github.com/winterssy/music-get/conf"
@@ -25,6 +27,8 @@ const (
 	GetArtist   = WeAPI + "/v1/artist"
 	GetAlbum    = WeAPI + "/v1/album"
 	GetPlaylist = WeAPI + "/v3/playlist/detail"
+	GetLyrics   = WeAPI + "/song/lyric"
+	Search      = WeAPI + "/cloudsearch/get/web"
 
 	BatchSongsCount = 1000
 )
@@ -104,6 +108,49 @@ type (
 		Response PlaylistResponse
 	}
 
+	LyricsParams struct {
+		Id int `json:"id"`
+		Lv int `json:"lv"`
+		Tv int `json:"tv"`
+	}
+
+	LyricsResponse struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+		Lrc  struct {
+			Lyric string `json:"lyric"`
+		} `json:"lrc"`
+		TLyric struct {
+			Lyric string `json:"lyric"`
+		} `json:"tlyric"`
+	}
+
+	LyricsRequest struct {
+		Params   LyricsParams
+		Response LyricsResponse
+	}
+
+	SearchParams struct {
+		S      string `json:"s"`
+		Type   int    `json:"type"`
+		Limit  int    `json:"limit"`
+		Offset int    `json:"offset"`
+	}
+
+	SearchResponse struct {
+		Code   int    `json:"code"`
+		Msg    string `json:"msg"`
+		Result struct {
+			Songs     []*Song `json:"songs"`
+			SongCount int     `json:"songCount"`
+		} `json:"result"`
+	}
+
+	SearchRequest struct {
+		Params   SearchParams
+		Response SearchResponse
+	}
+
 	LoginParams struct {
 		Phone         string `json:"phone"`
 		Password      string `json:"password"`
@@ -122,21 +169,23 @@ type (
 	}
 )
 
+// NewSongURLRequest requests the song urls of the configured quality,
+// netease steps down to the best available bit rate automatically.
 func NewSongURLRequest(ids ...int) *SongURLRequest {
-	br := conf.DefaultDownloadBr
-	switch br {
-	case 128, 192, 320:
-		br *= 1000
-	default:
+	br := 128 * 1000
+	switch conf.Conf.Quality {
+	case conf.QualityHigh:
+		br = 320 * 1000
+	case conf.QualityLossless:
 		br = 999 * 1000
 	}
 	enc, _ := json.Marshal(ids)
 	return &SongURLRequest{Params: SongURLParams{Ids: string(enc), Br: br}}
 }
 
-func (s *SongURLRequest) Do() error {
+func (s *SongURLRequest) Do(ctx context.Context) error {
 	easylog.Debug("SongURLRequest: send GetSongURL api request")
-	err := request(GetSongURL, s.Params).
+	err := request(ctx, GetSongURL, s.Params).
 		JSON(&s.Response)
 	if err != nil {
 		return fmt.Errorf("SongURLRequest: GetSongURL api request error: %w", err)
@@ -168,9 +217,9 @@ func (s *SongRequest) Login() error {
 	return login()
 }
 
-func (s *SongRequest) Do() error {
+func (s *SongRequest) Do(ctx context.Context) error {
 	easylog.Debug("SongRequest: send GetSong api request")
-	err := request(GetSong, s.Params).
+	err := request(ctx, GetSong, s.Params).
 		JSON(&s.Response)
 	if err != nil {
 		return fmt.Errorf("SongRequest: GetSong api request error: %w", err)
@@ -184,8 +233,8 @@ func (s *SongRequest) Do() error {
 	return nil
 }
 
-func (s *SongRequest) Prepare() ([]*provider.MP3, error) {
-	return prepare(s.Response.Songs, ".")
+func (s *SongRequest) Prepare(ctx context.Context) ([]*provider.MP3, error) {
+	return prepare(ctx, s.Response.Songs, ".")
 }
 
 func NewArtistRequest(id int) *ArtistRequest {
@@ -200,9 +249,9 @@ func (a *ArtistRequest) Login() error {
 	return login()
 }
 
-func (a *ArtistRequest) Do() error {
+func (a *ArtistRequest) Do(ctx context.Context) error {
 	easylog.Debugf("ArtistRequest: send GetArtist api request: %d", a.Id)
-	err := request(GetArtist+"/"+strconv.Itoa(a.Id), a.Params).
+	err := request(ctx, GetArtist+"/"+strconv.Itoa(a.Id), a.Params).
 		JSON(&a.Response)
 	if err != nil {
 		return fmt.Errorf("ArtistRequest: GetArtist api request error: %w", err)
@@ -220,19 +269,19 @@ func (a *ArtistRequest) Do() error {
 	return nil
 }
 
-func (a *ArtistRequest) Prepare() ([]*provider.MP3, error) {
+func (a *ArtistRequest) Prepare(ctx context.Context) ([]*provider.MP3, error) {
 	ids := make([]int, 0, len(a.Response.HotSongs))
 	for _, i := range a.Response.HotSongs {
 		ids = append(ids, i.Id)
 	}
 
 	req := NewSongRequest(ids...)
-	if err := req.Do(); err != nil {
+	if err := req.Do(ctx); err != nil {
 		return nil, err
 	}
 
 	savePath := filepath.Join(".", utils.TrimInvalidFilePathChars(a.Response.Artist.Name))
-	return prepare(req.Response.Songs, savePath)
+	return prepare(ctx, req.Response.Songs, savePath)
 }
 
 func NewAlbumRequest(id int) *AlbumRequest {
@@ -247,9 +296,9 @@ func (a *AlbumRequest) Login() error {
 	return login()
 }
 
-func (a *AlbumRequest) Do() error {
+func (a *AlbumRequest) Do(ctx context.Context) error {
 	easylog.Debugf("AlbumRequest: send GetAlbum api request: %d", a.Id)
-	err := request(GetAlbum+"/"+strconv.Itoa(a.Id), a.Params).
+	err := request(ctx, GetAlbum+"/"+strconv.Itoa(a.Id), a.Params).
 		JSON(&a.Response)
 	if err != nil {
 		return fmt.Errorf("AlbumRequest: GetAlbum api request error: %w", err)
@@ -267,12 +316,17 @@ func (a *AlbumRequest) Do() error {
 	return nil
 }
 
-func (a *AlbumRequest) Prepare() ([]*provider.MP3, error) {
+func (a *AlbumRequest) Prepare(ctx context.Context) ([]*provider.MP3, error) {
 	savePath := filepath.Join(".", utils.TrimInvalidFilePathChars(a.Response.Album.Name))
 	for i := range a.Response.Songs {
 		a.Response.Songs[i].PublishTime = a.Response.Album.PublishTime
+		a.Response.Songs[i].Album.Artists = a.Response.Album.Artists
 	}
-	return prepare(a.Response.Songs, savePath)
+	return prepare(ctx, a.Response.Songs, savePath)
+}
+
+func (a *AlbumRequest) CollectionName() string {
+	return strings.TrimSpace(a.Response.Album.Name)
 }
 
 func NewPlaylistRequest(id int) *PlaylistRequest {
@@ -287,9 +341,9 @@ func (p *PlaylistRequest) Login() error {
 	return login()
 }
 
-func (p *PlaylistRequest) Do() error {
+func (p *PlaylistRequest) Do(ctx context.Context) error {
 	easylog.Debugf("PlaylistRequest: send GetPlaylist api request: %d", p.Params.Id)
-	err := request(GetPlaylist, p.Params).
+	err := request(ctx, GetPlaylist, p.Params).
 		JSON(&p.Response)
 	if err != nil {
 		return fmt.Errorf("PlaylistRequest: GetPlaylist api request error: %w", err)
@@ -307,7 +361,7 @@ func (p *PlaylistRequest) Do() error {
 	return nil
 }
 
-func (p *PlaylistRequest) Prepare() ([]*provider.MP3, error) {
+func (p *PlaylistRequest) Prepare(ctx context.Context) ([]*provider.MP3, error) {
 	savePath := filepath.Join(".", utils.TrimInvalidFilePathChars(p.Response.Playlist.Name))
 	n := len(p.Response.Playlist.TrackIds)
 	mp3List := make([]*provider.MP3, 0, n)
@@ -324,11 +378,11 @@ func (p *PlaylistRequest) Prepare() ([]*provider.MP3, error) {
 		}
 
 		req := NewSongRequest(ids...)
-		if err := req.Do(); err != nil {
+		if err := req.Do(ctx); err != nil {
 			return nil, err
 		}
 
-		batch, err := prepare(req.Response.Songs, savePath)
+		batch, err := prepare(ctx, req.Response.Songs, savePath)
 		if err != nil {
 			return nil, err
 		}
@@ -338,15 +392,60 @@ func (p *PlaylistRequest) Prepare() ([]*provider.MP3, error) {
 	return mp3List, nil
 }
 
+func (p *PlaylistRequest) CollectionName() string {
+	return strings.TrimSpace(p.Response.Playlist.Name)
+}
+
+func NewLyricsRequest(id int) *LyricsRequest {
+	return &LyricsRequest{Params: LyricsParams{Id: id, Lv: -1, Tv: -1}}
+}
+
+func (l *LyricsRequest) Do(ctx context.Context) error {
+	easylog.Debugf("LyricsRequest: send GetLyrics api request: %d", l.Params.Id)
+	err := request(ctx, GetLyrics, l.Params).
+		JSON(&l.Response)
+	if err != nil {
+		return fmt.Errorf("LyricsRequest: GetLyrics api request error: %w", err)
+	}
+
+	if l.Response.Code != http.StatusOK {
+		return fmt.Errorf("LyricsRequest: GetLyrics api status error: %d: %s",
+			l.Response.Code, l.Response.Msg)
+	}
+
+	return nil
+}
+
+// NewSearchRequest searches songs by keyword, type 1 means songs.
+func NewSearchRequest(keyword string, limit int) *SearchRequest {
+	return &SearchRequest{Params: SearchParams{S: keyword, Type: 1, Limit: limit}}
+}
+
+func (s *SearchRequest) Do(ctx context.Context) error {
+	easylog.Debugf("SearchRequest: send Search api request: %s", s.Params.S)
+	err := request(ctx, Search, s.Params).
+		JSON(&s.Response)
+	if err != nil {
+		return fmt.Errorf("SearchRequest: Search api request error: %w", err)
+	}
+
+	if s.Response.Code != http.StatusOK {
+		return fmt.Errorf("SearchRequest: Search api status error: %d: %s",
+			s.Response.Code, s.Response.Msg)
+	}
+
+	return nil
+}
+
 func NewLoginRequest(phone, password string) *LoginRequest {
 	passwordHash := md5.Sum([]byte(password))
 	password = hex.EncodeToString(passwordHash[:])
 	return &LoginRequest{Params: LoginParams{Phone: phone, Password: password, RememberLogin: true}}
 }
 
-func (l *LoginRequest) Do() error {
+func (l *LoginRequest) Do(ctx context.Context) error {
 	easylog.Debug("LoginRequest: send Login api request")
-	resp := request(Login, l.Params)
+	resp := request(ctx, Login, l.Params)
 	if err := resp.JSON(&l.Response); err != nil {
 		return fmt.Errorf("LoginRequest: Login api request error: %w", err)
 	}
@@ -360,7 +459,7 @@ func (l *LoginRequest) Do() error {
 	return nil
 }
 
-func request(url string, data interface{}) *sreq.Response {
+func request(ctx context.Context, url string, data interface{}) *sreq.Response {
 	enc, _ := json.Marshal(data)
 	params, encSecKey, err := Encrypt(enc)
 	if err != nil {
@@ -369,8 +468,14 @@ func request(url string, data interface{}) *sreq.Response {
 		}
 	}
 
-	return provider.Client(provider.NetEaseMusic).
-		Post(url,
-			sreq.WithForm(sreq.Form{"params": params, "encSecKey": encSecKey}),
-		).EnsureStatusOk()
+	return provider.Retry(ctx, func() *sreq.Response {
+		if err := provider.WaitRateLimit(ctx, provider.NetEaseMusic, url); err != nil {
+			return &sreq.Response{Err: err}
+		}
+		return provider.Client(provider.NetEaseMusic).
+			Post(url,
+				sreq.WithForm(sreq.Form{"params": params, "encSecKey": encSecKey}),
+				sreq.WithContext(ctx),
+			)
+	}).EnsureStatusOk()
 }
@@ -2,6 +2,7 @@ package netease
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -32,5 +33,5 @@ func login() error {
 	password := string(bytePassword)
 
 	req := NewLoginRequest(strings.TrimSpace(phone), strings.TrimSpace(password))
-	return req.Do()
+	return req.Do(context.Background())
 }
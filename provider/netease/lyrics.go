@@ -0,0 +1,29 @@
+package netease
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/winterssy/music-get/pkg/lrc"
+	"github.com/winterssy/music-get/provider"
+)
+
+func init() {
+	provider.RegisterLyricsFunc(provider.NetEaseMusic, fetchLyrics)
+}
+
+func fetchLyrics(ctx context.Context, track *provider.Track) (*lrc.Lyrics, error) {
+	id, err := strconv.Atoi(track.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	req := NewLyricsRequest(id)
+	if err = req.Do(ctx); err != nil {
+		return nil, err
+	}
+
+	lyrics := lrc.Parse(req.Response.Lrc.Lyric)
+	lyrics.Merge(lrc.Parse(req.Response.TLyric.Lyric))
+	return lyrics, nil
+}
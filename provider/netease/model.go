@@ -2,7 +2,9 @@ package netease
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/winterssy/music-get/provider"
 	"github.com/winterssy/music-get/utils"
@@ -15,16 +17,19 @@ type (
 	}
 
 	Album struct {
-		Id          int    `json:"id"`
-		Name        string `json:"name"`
-		PicURL      string `json:"picURL"`
-		PublishTime int64  `json:"publishTime"`
+		Id          int      `json:"id"`
+		Name        string   `json:"name"`
+		PicURL      string   `json:"picURL"`
+		PublishTime int64    `json:"publishTime"`
+		Artists     []Artist `json:"artists"`
 	}
 
 	SongURL struct {
 		Id   int    `json:"id"`
 		Code int    `json:"code"`
 		URL  string `json:"url"`
+		Br   int    `json:"br"`
+		Type string `json:"type"`
 	}
 
 	Song struct {
@@ -33,6 +38,8 @@ type (
 		Artist      []Artist `json:"ar"`
 		Album       Album    `json:"al"`
 		Position    int      `json:"no"`
+		CD          string   `json:"cd"`
+		Duration    int64    `json:"dt"`
 		PublishTime int64    `json:"publishTime"`
 	}
 
@@ -55,9 +62,36 @@ func (s *Song) resolve() *provider.MP3 {
 		artists = append(artists, strings.TrimSpace(ar.Name))
 	}
 
+	albumArtist := ""
+	if len(s.Album.Artists) > 0 {
+		albumArtist = strings.TrimSpace(s.Album.Artists[0].Name)
+	}
+
+	// cd is formatted as "01" or "1/2"
+	disc, _ := strconv.Atoi(strings.SplitN(s.CD, "/", 2)[0])
+
 	fileName := utils.TrimInvalidFilePathChars(fmt.Sprintf("%s - %s.mp3", strings.Join(artists, " "), title))
 	return &provider.MP3{
 		FileName: fileName,
 		Provider: provider.NetEaseMusic,
+		Track: &provider.Track{
+			Id:          strconv.Itoa(s.Id),
+			Title:       title,
+			Artists:     artists,
+			Album:       strings.TrimSpace(s.Album.Name),
+			AlbumArtist: albumArtist,
+			TrackNumber: s.Position,
+			DiscNumber:  disc,
+			ReleaseDate: publishDate(s.PublishTime),
+			Duration:    time.Duration(s.Duration) * time.Millisecond,
+			CoverURL:    s.Album.PicURL,
+		},
+	}
+}
+
+func publishDate(ms int64) time.Time {
+	if ms <= 0 {
+		return time.Time{}
 	}
+	return time.Unix(ms/1000, 0)
 }
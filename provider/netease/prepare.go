@@ -1,10 +1,12 @@
 package netease
 
 import (
+	"context"
+
 	"github.com/winterssy/music-get/provider"
 )
 
-func prepare(songs []*Song, savePath string) ([]*provider.MP3, error) {
+func prepare(ctx context.Context, songs []*Song, savePath string) ([]*provider.MP3, error) {
 	n := len(songs)
 	ids := make([]int, 0, n)
 	for _, i := range songs {
@@ -12,22 +14,26 @@ func prepare(songs []*Song, savePath string) ([]*provider.MP3, error) {
 	}
 
 	req := NewSongURLRequest(ids...)
-	if err := req.Do(); err != nil {
+	if err := req.Do(ctx); err != nil {
 		return nil, err
 	}
 
-	codeMap, urlMap := make(map[int]int, n), make(map[int]string, n)
+	urlMap := make(map[int]*SongURL, n)
 	for _, i := range req.Response.Data {
-		codeMap[i.Id] = i.Code
-		urlMap[i.Id] = i.URL
+		urlMap[i.Id] = i
 	}
 
 	mp3List := make([]*provider.MP3, 0, n)
 	for _, i := range songs {
 		mp3 := i.resolve()
 		mp3.SavePath = savePath
-		mp3.Playable = codeMap[i.Id] == 200
-		mp3.DownloadURL = urlMap[i.Id]
+		if u, ok := urlMap[i.Id]; ok {
+			mp3.Playable = u.Code == 200
+			mp3.DownloadURL = u.URL
+			mp3.Track.BitRate = u.Br / 1000
+			// type is "mp3" or "flac"
+			mp3.SetExt(u.Type)
+		}
 		mp3List = append(mp3List, mp3)
 	}
 
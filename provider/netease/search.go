@@ -0,0 +1,38 @@
+package netease
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/winterssy/music-get/provider"
+)
+
+func init() {
+	provider.RegisterSearchFunc(provider.NetEaseMusic, search)
+	provider.RegisterSongRequestFunc(provider.NetEaseMusic, newSongRequest)
+}
+
+func search(ctx context.Context, keyword string, limit int) ([]*provider.SearchResult, error) {
+	req := NewSearchRequest(keyword, limit)
+	if err := req.Do(ctx); err != nil {
+		return nil, err
+	}
+
+	results := make([]*provider.SearchResult, 0, len(req.Response.Result.Songs))
+	for _, i := range req.Response.Result.Songs {
+		results = append(results, &provider.SearchResult{
+			Track:    i.resolve().Track,
+			Provider: provider.NetEaseMusic,
+			Request:  NewSongRequest(i.Id),
+		})
+	}
+	return results, nil
+}
+
+func newSongRequest(id string) (provider.MusicRequest, error) {
+	i, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, err
+	}
+	return NewSongRequest(i), nil
+}
@@ -1,18 +1,24 @@
 package provider
 
 import (
-	"io"
+	"context"
+	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
-	"github.com/cheggaaa/pb/v3"
 	"github.com/winterssy/easylog"
 	"github.com/winterssy/music-get/conf"
 	"github.com/winterssy/music-get/internal/ecode"
-	"github.com/winterssy/music-get/pkg/concurrency"
+	"github.com/winterssy/music-get/pkg/lrc"
 	"github.com/winterssy/music-get/utils"
 )
 
+const (
+	releaseDateLayout = "2006-01-02"
+)
+
 const (
 	NetEaseMusic = iota
 	QQMusic
@@ -21,6 +27,17 @@ const (
 	KuwoMusic
 )
 
+var (
+	// platformNames are the short names of the platforms used in command options and config
+	platformNames = map[int]string{
+		NetEaseMusic: "netease",
+		QQMusic:      "qq",
+		MiguMusic:    "migu",
+		KugouMusic:   "kugou",
+		KuwoMusic:    "kuwo",
+	}
+)
+
 type (
 	MusicRequest interface {
 		// 是否需要登录
@@ -28,9 +45,16 @@ type (
 		// 发起登录请求
 		Login() error
 		// 发起API请求
-		Do() error
+		Do(ctx context.Context) error
 		// 解析API响应获取音源
-		Prepare() ([]*MP3, error)
+		Prepare(ctx context.Context) ([]*MP3, error)
+	}
+
+	// Collection is implemented by the requests of albums and playlists,
+	// whose songs are prepared in the order of the platform.
+	Collection interface {
+		// 专辑或歌单名称，发起API请求后可用
+		CollectionName() string
 	}
 
 	MP3 struct {
@@ -39,136 +63,201 @@ type (
 		Playable    bool
 		DownloadURL string
 		Provider    int
+		Track       *Track
+		// Origin is the unavailable song which m is downloaded in place of, nil if not a fallback
+		Origin *MP3
+
+		lyrics *lrc.Lyrics
+	}
+
+	// Track holds the provider-neutral metadata of a song.
+	Track struct {
+		Id          string        `json:"id"`
+		Title       string        `json:"title"`
+		Artists     []string      `json:"artists,omitempty"`
+		Album       string        `json:"album,omitempty"`
+		AlbumArtist string        `json:"albumArtist,omitempty"`
+		TrackNumber int           `json:"trackNumber,omitempty"`
+		DiscNumber  int           `json:"discNumber,omitempty"`
+		ReleaseDate time.Time     `json:"-"`
+		Duration    time.Duration `json:"-"`
+		CoverURL    string        `json:"coverURL,omitempty"`
+		BitRate     int           `json:"bitRate,omitempty"`
 	}
 
+	// DownloadTask is the result of downloading a song.
 	DownloadTask struct {
 		MP3    *MP3
 		Status int
+		// Path is the final path of the music file
+		Path string
+		// Bytes is the size of the downloaded music file
+		Bytes   int64
+		Elapsed time.Duration
 	}
 )
 
-func (m *MP3) SingleDownload() (status int) {
-	defer func() {
-		switch status {
-		case ecode.Success:
-			easylog.Infof("Download complete")
-		case ecode.SongUnavailable, ecode.AlreadyDownloaded:
-			easylog.Warnf("Download interrupt: %s", ecode.Message(status))
-		default:
-			easylog.Errorf("Download error: %s", ecode.Message(status))
-		}
-	}()
+// PlatformName returns the short name of the platform, such as "netease".
+func PlatformName(platform int) string {
+	return platformNames[platform]
+}
 
-	easylog.Infof("Downloading: %s", m.FileName)
-	if !m.Playable || m.DownloadURL == "" {
-		status = ecode.SongUnavailable
-		return
+// ParsePlatform returns the platform of the short name.
+func ParsePlatform(name string) (int, bool) {
+	for k, v := range platformNames {
+		if v == name {
+			return k, true
+		}
 	}
+	return 0, false
+}
 
-	m.SavePath = filepath.Join(conf.Conf.DownloadDir, m.SavePath)
-	if err := utils.BuildPathIfNotExist(m.SavePath); err != nil {
-		status = ecode.BuildPathException
-		return
+// Year returns the release year of t, 0 if unknown.
+func (t *Track) Year() int {
+	if t.ReleaseDate.IsZero() {
+		return 0
 	}
+	return t.ReleaseDate.Year()
+}
 
-	fPath := filepath.Join(m.SavePath, m.FileName)
-	if !conf.Conf.DownloadOverwrite {
-		if downloaded, _ := utils.ExistsPath(fPath); downloaded {
-			status = ecode.AlreadyDownloaded
-			return
-		}
+// MarshalJSON encodes the release date as "2006-01-02" and the duration in milliseconds,
+// both are omitted if unknown.
+func (t *Track) MarshalJSON() ([]byte, error) {
+	type track Track
+	v := struct {
+		*track
+		ReleaseDate string `json:"releaseDate,omitempty"`
+		DurationMs  int64  `json:"durationMs,omitempty"`
+	}{track: (*track)(t), DurationMs: t.Duration.Milliseconds()}
+	if !t.ReleaseDate.IsZero() {
+		v.ReleaseDate = t.ReleaseDate.Format(releaseDateLayout)
 	}
+	return json.Marshal(v)
+}
 
-	easylog.Debugf("URL: %s", m.DownloadURL)
-	resp, err := Client(m.Provider).
-		Get(m.DownloadURL).
-		Resolve()
-	if err != nil {
-		status = ecode.HTTPRequestException
-		return
+// UnmarshalJSON decodes t in the form of MarshalJSON.
+func (t *Track) UnmarshalJSON(data []byte) error {
+	type track Track
+	v := struct {
+		*track
+		ReleaseDate string `json:"releaseDate"`
+		DurationMs  int64  `json:"durationMs"`
+	}{track: (*track)(t)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
 	}
-	defer resp.Body.Close()
-
-	f, err := os.OpenFile(fPath, os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		status = ecode.BuildFileException
-		return
+	t.Duration = time.Duration(v.DurationMs) * time.Millisecond
+	t.ReleaseDate = time.Time{}
+	if v.ReleaseDate != "" {
+		date, err := time.Parse(releaseDateLayout, v.ReleaseDate)
+		if err != nil {
+			return err
+		}
+		t.ReleaseDate = date
 	}
-	defer f.Close()
+	return nil
+}
 
-	bar := pb.Full.Start64(resp.ContentLength)
-	bar.Start()
-	barReader := bar.NewProxyReader(resp.Body)
-	n, err := io.Copy(f, barReader)
-	if err != nil || n != resp.ContentLength {
-		status = ecode.FileTransferException
-		return
+// AlbumArtistOrDefault returns the album artist of t, fallback to the first artist.
+func (t *Track) AlbumArtistOrDefault() string {
+	if t.AlbumArtist != "" || len(t.Artists) == 0 {
+		return t.AlbumArtist
 	}
-
-	bar.Finish()
-	status = ecode.Success
-	return
+	return t.Artists[0]
 }
 
-func (m *MP3) ConcurrentDownload(taskList chan DownloadTask, c *concurrency.C) {
-	var status int
+// Key returns an identifier of the song which is unique across providers, empty if unknown.
+func (m *MP3) Key() string {
+	if m.Track == nil || m.Track.Id == "" {
+		return ""
+	}
+	return fmt.Sprintf("%d:%s", m.Provider, m.Track.Id)
+}
 
+// Download downloads m into the download directory, progress is optional. The task is canceled without starting
+// if ctx is already done, or aborted with the partial files removed if ctx is done during the transfer.
+func (m *MP3) Download(ctx context.Context, progress ProgressFunc) (task DownloadTask) {
+	start := time.Now()
 	defer func() {
-		switch status {
-		case ecode.Success:
-			easylog.Infof("Download complete: %s", m.FileName)
-		case ecode.SongUnavailable, ecode.AlreadyDownloaded:
-			easylog.Warnf("Download interrupt: %s: %s", m.FileName, ecode.Message(status))
-		default:
-			easylog.Errorf("Download error: %s: %s", m.FileName, ecode.Message(status))
-		}
-		c.Done()
-		taskList <- DownloadTask{m, status}
+		task.Elapsed = time.Since(start)
 	}()
 
-	easylog.Infof("Downloading: %s", m.FileName)
-	if !m.Playable || m.DownloadURL == "" {
-		status = ecode.SongUnavailable
+	m.SavePath = filepath.Join(conf.Conf.DownloadDir, m.SavePath)
+	task.MP3, task.Path = m, filepath.Join(m.SavePath, m.FileName)
+	if ctx.Err() != nil {
+		task.Status = ecode.DownloadCanceled
 		return
 	}
 
-	m.SavePath = filepath.Join(conf.Conf.DownloadDir, m.SavePath)
-	if err := utils.BuildPathIfNotExist(m.SavePath); err != nil {
-		status = ecode.BuildPathException
+	if !m.Playable || m.DownloadURL == "" {
+		task.Status = ecode.SongUnavailable
 		return
 	}
 
-	fPath := filepath.Join(m.SavePath, m.FileName)
 	if !conf.Conf.DownloadOverwrite {
-		if downloaded, _ := utils.ExistsPath(fPath); downloaded {
-			status = ecode.AlreadyDownloaded
+		r, recorded := HistoryRecord(m)
+		if downloaded, _ := utils.ExistsPath(task.Path); downloaded {
+			// the files downloaded before the history is kept are recorded as well
+			if !recorded {
+				m.recordHistory(task.Path)
+			}
+			task.Status = ecode.AlreadyDownloaded
+			return
+		}
+		// not downloaded again if the file is saved to another path, or moved out of band
+		if recorded {
+			easylog.Debugf("Downloaded before: %s: %s", m.FileName, r.Path)
+			if exists, _ := utils.ExistsPath(r.Path); exists {
+				task.Status, task.Path = ecode.AlreadyDownloaded, r.Path
+			} else {
+				task.Status = ecode.DownloadedBefore
+			}
 			return
 		}
 	}
 
-	easylog.Debugf("URL: %s", m.DownloadURL)
-	resp, err := Client(m.Provider).
-		Get(m.DownloadURL).
-		Resolve()
-	if err != nil {
-		status = ecode.HTTPRequestException
+	if err := utils.BuildPathIfNotExist(m.SavePath); err != nil {
+		task.Status = ecode.BuildPathException
 		return
 	}
-	defer resp.Body.Close()
 
-	f, err := os.Create(fPath)
-	if err != nil {
-		status = ecode.BuildFileException
+	easylog.Debugf("URL: %s", m.DownloadURL)
+	if task.Status = m.transfer(ctx, task.Path, progress); task.Status != ecode.Success {
 		return
 	}
-	defer f.Close()
 
-	n, err := io.Copy(f, resp.Body)
-	if err != nil || n != resp.ContentLength {
-		status = ecode.FileTransferException
-		return
+	if conf.Conf.VerifyAudio {
+		if err := m.verify(task.Path); err != nil {
+			easylog.Debugf("Verify failed: %s: %s", m.FileName, err.Error())
+			// an invalid file would be regarded as downloaded in the next run
+			os.Remove(task.Path)
+			task.Status = ecode.AudioVerifyException
+			return
+		}
 	}
 
-	status = ecode.Success
+	if fi, err := os.Stat(task.Path); err == nil {
+		task.Bytes = fi.Size()
+	}
+	m.postProcess(ctx, task.Path)
+	m.recordHistory(task.Path)
 	return
 }
+
+// postProcess saves lyrics and cover, embeds tags after the music file is downloaded,
+// errors are logged only since the music file itself is fine.
+func (m *MP3) postProcess(ctx context.Context, fPath string) {
+	if conf.Conf.DownloadLyrics {
+		if err := m.saveLyrics(ctx, fPath); err != nil {
+			easylog.Warnf("Save lyrics failed: %s: %s", m.FileName, err.Error())
+		}
+	}
+	if conf.Conf.SaveCover {
+		if err := m.saveCover(ctx, filepath.Dir(fPath)); err != nil {
+			easylog.Warnf("Save cover failed: %s: %s", m.FileName, err.Error())
+		}
+	}
+	if err := m.embedTag(ctx, fPath); err != nil {
+		easylog.Warnf("Embed tag failed: %s: %s", m.FileName, err.Error())
+	}
+}
@@ -0,0 +1,42 @@
+package provider
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrack_JSON(t *testing.T) {
+	track := &Track{
+		Id:          "1",
+		Title:       "晴天",
+		ReleaseDate: time.Date(2003, 7, 31, 0, 0, 0, 0, time.UTC),
+		Duration:    269500 * time.Millisecond,
+	}
+	data, err := json.Marshal(track)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"id":"1","title":"晴天","releaseDate":"2003-07-31","durationMs":269500}`
+	if string(data) != want {
+		t.Errorf("Marshal got %s, want %s", data, want)
+	}
+
+	got := new(Track)
+	if err = json.Unmarshal(data, got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, track) {
+		t.Errorf("Unmarshal got %+v, want %+v", got, track)
+	}
+
+	// unknown date and duration are omitted
+	if data, err = json.Marshal(&Track{Id: "2"}); err != nil {
+		t.Fatal(err)
+	}
+	if s := string(data); strings.Contains(s, "releaseDate") || strings.Contains(s, "duration") {
+		t.Errorf("Marshal got %s", s)
+	}
+}
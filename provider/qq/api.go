@@ -1,10 +1,13 @@
 package qq
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/winterssy/easylog"
 	"github.com/winterssy/music-get/provider"
@@ -18,6 +21,8 @@ const (
 	GetArtist   = "https://c.y.qq.com/v8/fcg-bin/fcg_v8_singer_track_cp.fcg?begin=0&num=50&order=listen&newsong=1&platform=yqq&format=json"
 	GetAlbum    = "https://c.y.qq.com/v8/fcg-bin/fcg_v8_album_detail_cp.fcg?newsong=1&platform=yqq&format=json"
 	GetPlaylist = "https://c.y.qq.com/v8/fcg-bin/fcg_v8_playlist_cp.fcg?newsong=1&platform=yqq&format=json"
+	GetLyrics   = "https://c.y.qq.com/lyric/fcgi-bin/fcg_query_lyric_new.fcg?format=json"
+	Search      = "https://c.y.qq.com/soso/fcgi-bin/client_search_cp?p=1&t=0&new_json=1&cr=1&format=json"
 )
 
 type (
@@ -94,9 +99,38 @@ type (
 		Params   sreq.Params
 		Response PlaylistResponse
 	}
+
+	LyricsResponse struct {
+		Code   int    `json:"code"`
+		Lyric  string `json:"lyric"`
+		Trans  string `json:"trans"`
+		SubMsg string `json:"subMsg"`
+	}
+
+	LyricsRequest struct {
+		Params   sreq.Params
+		Response LyricsResponse
+	}
+
+	SearchResponse struct {
+		Code int `json:"code"`
+		Data struct {
+			Song struct {
+				List     []*Song `json:"list"`
+				TotalNum int     `json:"totalnum"`
+			} `json:"song"`
+		} `json:"data"`
+	}
+
+	SearchRequest struct {
+		Params   sreq.Params
+		Response SearchResponse
+	}
 )
 
-func NewSongURLRequest(guid string, songMids ...string) *SongURLRequest {
+// NewSongURLRequest requests the song urls of the specified files, such as "M800{mid}{mid}.mp3",
+// fileNames must correspond to songMids, or be nil to request the default files.
+func NewSongURLRequest(guid string, fileNames []string, songMids ...string) *SongURLRequest {
 	param := map[string]interface{}{
 		"guid":      guid,
 		"loginflag": 1,
@@ -104,6 +138,9 @@ func NewSongURLRequest(guid string, songMids ...string) *SongURLRequest {
 		"uin":       "0",
 		"platform":  "20",
 	}
+	if len(fileNames) > 0 {
+		param["filename"] = fileNames
+	}
 	req0 := map[string]interface{}{
 		"module": "vkey.GetVkeyServer",
 		"method": "CgiGetVkey",
@@ -121,9 +158,9 @@ func NewSongURLRequest(guid string, songMids ...string) *SongURLRequest {
 	return &SongURLRequest{Params: params}
 }
 
-func (s *SongURLRequest) Do() error {
+func (s *SongURLRequest) Do(ctx context.Context) error {
 	easylog.Debug("SongURLRequest: send GetSongURL api request")
-	err := request(GetSongURL,
+	err := request(ctx, GetSongURL,
 		sreq.WithQuery(s.Params),
 	).JSON(&s.Response)
 	if err != nil {
@@ -155,9 +192,9 @@ func (s *SongRequest) Login() error {
 	panic("implement me")
 }
 
-func (s *SongRequest) Do() error {
+func (s *SongRequest) Do(ctx context.Context) error {
 	easylog.Debug("SongRequest: send GetSong api request")
-	err := request(GetSong,
+	err := request(ctx, GetSong,
 		sreq.WithQuery(s.Params),
 	).JSON(&s.Response)
 	if err != nil {
@@ -171,8 +208,8 @@ func (s *SongRequest) Do() error {
 	return nil
 }
 
-func (s *SongRequest) Prepare() ([]*provider.MP3, error) {
-	return prepare(s.Response.Data, ".")
+func (s *SongRequest) Prepare(ctx context.Context) ([]*provider.MP3, error) {
+	return prepare(ctx, s.Response.Data, ".")
 }
 
 func NewArtistRequest(singerMid string) *ArtistRequest {
@@ -190,9 +227,9 @@ func (a *ArtistRequest) Login() error {
 	panic("implement me")
 }
 
-func (a *ArtistRequest) Do() error {
+func (a *ArtistRequest) Do(ctx context.Context) error {
 	easylog.Debug("ArtistRequest: send GetArtist api request")
-	err := request(GetArtist,
+	err := request(ctx, GetArtist,
 		sreq.WithQuery(a.Params),
 	).JSON(&a.Response)
 	if err != nil {
@@ -210,13 +247,13 @@ func (a *ArtistRequest) Do() error {
 	return nil
 }
 
-func (a *ArtistRequest) Prepare() ([]*provider.MP3, error) {
+func (a *ArtistRequest) Prepare(ctx context.Context) ([]*provider.MP3, error) {
 	savePath := filepath.Join(".", utils.TrimInvalidFilePathChars(a.Response.Data.SingerName))
 	songs := make([]*Song, len(a.Response.Data.List))
 	for i, s := range a.Response.Data.List {
 		songs[i] = s.MusicData
 	}
-	return prepare(songs, savePath)
+	return prepare(ctx, songs, savePath)
 }
 
 func NewAlbumRequest(albumMid string) *AlbumRequest {
@@ -234,9 +271,9 @@ func (a *AlbumRequest) Login() error {
 	panic("implement me")
 }
 
-func (a *AlbumRequest) Do() error {
+func (a *AlbumRequest) Do(ctx context.Context) error {
 	easylog.Debug("AlbumRequest: send album api request")
-	err := request(GetAlbum,
+	err := request(ctx, GetAlbum,
 		sreq.WithQuery(a.Params),
 	).JSON(&a.Response)
 	if err != nil {
@@ -254,9 +291,22 @@ func (a *AlbumRequest) Do() error {
 	return nil
 }
 
-func (a *AlbumRequest) Prepare() ([]*provider.MP3, error) {
-	savePath := filepath.Join(".", utils.TrimInvalidFilePathChars(a.Response.Data.GetAlbumInfo.FAlbumName))
-	return prepare(a.Response.Data.GetSongInfo, savePath)
+func (a *AlbumRequest) Prepare(ctx context.Context) ([]*provider.MP3, error) {
+	albumInfo := a.Response.Data.GetAlbumInfo
+	savePath := filepath.Join(".", utils.TrimInvalidFilePathChars(albumInfo.FAlbumName))
+	mp3List, err := prepare(ctx, a.Response.Data.GetSongInfo, savePath)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, i := range mp3List {
+		i.Track.AlbumArtist = strings.TrimSpace(albumInfo.FSingerName)
+	}
+	return mp3List, nil
+}
+
+func (a *AlbumRequest) CollectionName() string {
+	return strings.TrimSpace(a.Response.Data.GetAlbumInfo.FAlbumName)
 }
 
 func NewPlaylistRequest(id string) *PlaylistRequest {
@@ -274,9 +324,9 @@ func (p *PlaylistRequest) Login() error {
 	panic("implement me")
 }
 
-func (p *PlaylistRequest) Do() error {
+func (p *PlaylistRequest) Do(ctx context.Context) error {
 	easylog.Debug("PlaylistRequest: send playlist api request")
-	err := request(GetPlaylist,
+	err := request(ctx, GetPlaylist,
 		sreq.WithQuery(p.Params),
 	).JSON(&p.Response)
 	if err != nil {
@@ -294,11 +344,11 @@ func (p *PlaylistRequest) Do() error {
 	return nil
 }
 
-func (p *PlaylistRequest) Prepare() ([]*provider.MP3, error) {
+func (p *PlaylistRequest) Prepare(ctx context.Context) ([]*provider.MP3, error) {
 	res := make([]*provider.MP3, 0, len(p.Response.Data.CDList))
 	for _, i := range p.Response.Data.CDList {
 		savePath := filepath.Join(".", utils.TrimInvalidFilePathChars(i.DissName))
-		mp3List, err := prepare(i.SongList, savePath)
+		mp3List, err := prepare(ctx, i.SongList, savePath)
 		if err != nil {
 			continue
 		}
@@ -308,8 +358,69 @@ func (p *PlaylistRequest) Prepare() ([]*provider.MP3, error) {
 	return res, nil
 }
 
-func request(url string, opts ...sreq.RequestOption) *sreq.Response {
-	return provider.Client(provider.QQMusic).
-		Get(url, opts...).
-		EnsureStatusOk()
+func (p *PlaylistRequest) CollectionName() string {
+	if len(p.Response.Data.CDList) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(p.Response.Data.CDList[0].DissName)
+}
+
+func NewLyricsRequest(songMid string) *LyricsRequest {
+	params := sreq.Params{
+		"songmid": songMid,
+	}
+	return &LyricsRequest{Params: params}
+}
+
+func (l *LyricsRequest) Do(ctx context.Context) error {
+	easylog.Debug("LyricsRequest: send GetLyrics api request")
+	err := request(ctx, GetLyrics,
+		sreq.WithQuery(l.Params),
+		sreq.WithHeaders(sreq.Headers{
+			"Referer": "https://y.qq.com/portal/player.html",
+		}),
+	).JSON(&l.Response)
+	if err != nil {
+		return fmt.Errorf("LyricsRequest: GetLyrics api request error: %w", err)
+	}
+
+	if l.Response.Code != 0 {
+		return fmt.Errorf("LyricsRequest: GetLyrics api status error: %d: %s",
+			l.Response.Code, l.Response.SubMsg)
+	}
+
+	return nil
+}
+
+func NewSearchRequest(keyword string, limit int) *SearchRequest {
+	params := sreq.Params{
+		"w": keyword,
+		"n": strconv.Itoa(limit),
+	}
+	return &SearchRequest{Params: params}
+}
+
+func (s *SearchRequest) Do(ctx context.Context) error {
+	easylog.Debug("SearchRequest: send Search api request")
+	err := request(ctx, Search,
+		sreq.WithQuery(s.Params),
+	).JSON(&s.Response)
+	if err != nil {
+		return fmt.Errorf("SearchRequest: Search api request error: %w", err)
+	}
+
+	if s.Response.Code != 0 {
+		return fmt.Errorf("SearchRequest: Search api status error: %d", s.Response.Code)
+	}
+
+	return nil
+}
+
+func request(ctx context.Context, url string, opts ...sreq.RequestOption) *sreq.Response {
+	return provider.Retry(ctx, func() *sreq.Response {
+		if err := provider.WaitRateLimit(ctx, provider.QQMusic, url); err != nil {
+			return &sreq.Response{Err: err}
+		}
+		return provider.Client(provider.QQMusic).Get(url, append(opts, sreq.WithContext(ctx))...)
+	}).EnsureStatusOk()
 }
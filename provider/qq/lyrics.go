@@ -0,0 +1,34 @@
+package qq
+
+import (
+	"context"
+	"encoding/base64"
+
+	"github.com/winterssy/music-get/pkg/lrc"
+	"github.com/winterssy/music-get/provider"
+)
+
+func init() {
+	provider.RegisterLyricsFunc(provider.QQMusic, fetchLyrics)
+}
+
+func fetchLyrics(ctx context.Context, track *provider.Track) (*lrc.Lyrics, error) {
+	req := NewLyricsRequest(track.Id)
+	if err := req.Do(ctx); err != nil {
+		return nil, err
+	}
+
+	// lyrics are base64 encoded
+	lyric, err := base64.StdEncoding.DecodeString(req.Response.Lyric)
+	if err != nil {
+		return nil, err
+	}
+	trans, err := base64.StdEncoding.DecodeString(req.Response.Trans)
+	if err != nil {
+		return nil, err
+	}
+
+	lyrics := lrc.Parse(string(lyric))
+	lyrics.Merge(lrc.Parse(string(trans)))
+	return lyrics, nil
+}
@@ -3,6 +3,7 @@ package qq
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/winterssy/music-get/provider"
 	"github.com/winterssy/music-get/utils"
@@ -22,9 +23,10 @@ type (
 	}
 
 	GetAlbumInfo struct {
-		FAlbumId   string `json:"Falbum_id"`
-		FAlbumMid  string `json:"Falbum_mid"`
-		FAlbumName string `json:"Falbum_name"`
+		FAlbumId    string `json:"Falbum_id"`
+		FAlbumMid   string `json:"Falbum_mid"`
+		FAlbumName  string `json:"Falbum_name"`
+		FSingerName string `json:"Fsinger_name"`
 	}
 
 	Song struct {
@@ -34,8 +36,17 @@ type (
 		Singer     []Singer `json:"singer"`
 		Album      Album    `json:"album"`
 		IndexAlbum int      `json:"index_album"`
+		IndexCD    int      `json:"index_cd"`
+		Interval   int      `json:"interval"`
 		TimePublic string   `json:"time_public"`
-		Action     struct {
+		File       struct {
+			MediaMid   string `json:"media_mid"`
+			Size128MP3 int    `json:"size_128mp3"`
+			Size320MP3 int    `json:"size_320mp3"`
+			SizeAPE    int    `json:"size_ape"`
+			SizeFLAC   int    `json:"size_flac"`
+		} `json:"file"`
+		Action struct {
 			Switch int `json:"switch"`
 		} `json:"action"`
 	}
@@ -57,9 +68,34 @@ func (s *Song) resolve() *provider.MP3 {
 	}
 
 	fileName := utils.TrimInvalidFilePathChars(fmt.Sprintf("%s - %s.m4a", strings.Join(artists, " "), title))
+	// index_cd counts from 0
+	disc := 0
+	if s.IndexAlbum > 0 {
+		disc = s.IndexCD + 1
+	}
+
+	releaseDate, _ := time.Parse("2006-01-02", s.TimePublic)
 	return &provider.MP3{
 		FileName: fileName,
 		Playable: true,
-		Provider: provider.MiguMusic,
+		Provider: provider.QQMusic,
+		Track: &provider.Track{
+			Id:          s.Mid,
+			Title:       title,
+			Artists:     artists,
+			Album:       strings.TrimSpace(s.Album.Name),
+			TrackNumber: s.IndexAlbum,
+			DiscNumber:  disc,
+			ReleaseDate: releaseDate,
+			Duration:    time.Duration(s.Interval) * time.Second,
+			CoverURL:    albumCoverURL(s.Album.Mid),
+		},
+	}
+}
+
+func albumCoverURL(albumMid string) string {
+	if albumMid == "" {
+		return ""
 	}
+	return fmt.Sprintf(AlbumCoverURL, albumMid)
 }
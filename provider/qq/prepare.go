@@ -1,17 +1,55 @@
 package qq
 
 import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/winterssy/easylog"
+	"github.com/winterssy/music-get/conf"
 	"github.com/winterssy/music-get/provider"
 )
 
 const (
-	SongDownloadURL = "http://aqqmusic.tc.qq.com/amobile.music.tc.qq.com/M500%s.mp3?guid=%s&vkey=%s&uin=0&fromtag=8"
+	AlbumCoverURL   = "https://y.gtimg.cn/music/photo_new/T002R300x300M000%s.jpg"
 	BatchSongsCount = 10
 )
 
-func prepare(songs []*Song, savePath string) ([]*provider.MP3, error) {
+type (
+	// fileFormat describes a file of the song stored on the server, such as "M800{mid}{mid}.mp3".
+	fileFormat struct {
+		prefix string
+		ext    string
+		size   func(s *Song) int
+	}
+)
+
+var (
+	fileFormats = map[int][]fileFormat{
+		conf.QualityLossless: {
+			{"F000", ".flac", func(s *Song) int { return s.File.SizeFLAC }},
+			{"A000", ".ape", func(s *Song) int { return s.File.SizeAPE }},
+		},
+		conf.QualityHigh: {
+			{"M800", ".mp3", func(s *Song) int { return s.File.Size320MP3 }},
+		},
+		conf.QualityStandard: {
+			{"M500", ".mp3", func(s *Song) int { return s.File.Size128MP3 }},
+		},
+	}
+)
+
+func (f fileFormat) fileName(s *Song) string {
+	mediaMid := s.File.MediaMid
+	if mediaMid == "" {
+		mediaMid = s.Mid
+	}
+	return f.prefix + s.Mid + mediaMid + f.ext
+}
+
+func prepare(ctx context.Context, songs []*Song, savePath string) ([]*provider.MP3, error) {
 	n := len(songs)
-	urlMap := make(map[string]string, n)
+	urlMap, fileMap := make(map[string]string, n), make(map[string]string, n)
 
 	guid := "7332953645"
 	for i := 0; i < n; i += BatchSongsCount {
@@ -20,30 +58,91 @@ func prepare(songs []*Song, savePath string) ([]*provider.MP3, error) {
 			j = n
 		}
 
-		mids := make([]string, 0, j-i)
-		for k := i; k < j; k++ {
-			mids = append(mids, songs[k].Mid)
-		}
+		// step down from the configured quality, files not listed in the song info are skipped
+		pending := songs[i:j]
+		for _, q := range provider.Qualities() {
+			for _, f := range fileFormats[q] {
+				mids, fileNames := make([]string, 0, len(pending)), make([]string, 0, len(pending))
+				for _, s := range pending {
+					if f.size(s) > 0 {
+						mids = append(mids, s.Mid)
+						fileNames = append(fileNames, f.fileName(s))
+					}
+				}
+				if len(mids) == 0 {
+					continue
+				}
 
-		req := NewSongURLRequest(guid, mids...)
-		if err := req.Do(); err != nil {
-			return nil, err
+				req := NewSongURLRequest(guid, fileNames, mids...)
+				if err := req.Do(ctx); err != nil {
+					easylog.Debugf("Get %s song urls failed: %s", f.prefix, err.Error())
+					continue
+				}
+				collectSongURLs(req, urlMap, fileMap)
+				pending = pendingSongs(pending, urlMap)
+			}
+		}
+		if len(pending) == 0 {
+			continue
 		}
 
-		sip := req.Response.Req0.Data.Sip
-		for _, i := range req.Response.Req0.Data.MidURLInfo {
-			if i.PURL != "" {
-				urlMap[i.SongMid] = sip[0] + i.PURL
-			}
+		// the default files, usually C400 m4a
+		mids := make([]string, 0, len(pending))
+		for _, s := range pending {
+			mids = append(mids, s.Mid)
 		}
+		req := NewSongURLRequest(guid, nil, mids...)
+		if err := req.Do(ctx); err != nil {
+			return nil, err
+		}
+		collectSongURLs(req, urlMap, fileMap)
 	}
 
 	mp3List := make([]*provider.MP3, 0, len(songs))
 	for _, i := range songs {
 		mp3 := i.resolve()
 		mp3.DownloadURL = urlMap[i.Mid]
+		if fileName, ok := fileMap[i.Mid]; ok {
+			mp3.Track.BitRate = bitRate(fileName)
+			mp3.SetExt(path.Ext(fileName))
+		}
 		mp3.SavePath = savePath
 		mp3List = append(mp3List, mp3)
 	}
 	return mp3List, nil
 }
+
+func collectSongURLs(req *SongURLRequest, urlMap, fileMap map[string]string) {
+	sip := req.Response.Req0.Data.Sip
+	for _, i := range req.Response.Req0.Data.MidURLInfo {
+		if i.PURL != "" {
+			urlMap[i.SongMid] = sip[0] + i.PURL
+			fileMap[i.SongMid] = i.FileName
+		}
+	}
+}
+
+func pendingSongs(songs []*Song, urlMap map[string]string) []*Song {
+	pending := make([]*Song, 0, len(songs))
+	for _, s := range songs {
+		if _, ok := urlMap[s.Mid]; !ok {
+			pending = append(pending, s)
+		}
+	}
+	return pending
+}
+
+// bitRate returns the bit rate (kbps) implied by the file name prefix, such as C400,
+// 0 for lossless files.
+func bitRate(fileName string) int {
+	switch {
+	case strings.HasPrefix(fileName, "C400"):
+		return 96
+	case strings.HasPrefix(fileName, "M500"):
+		return 128
+	case strings.HasPrefix(fileName, "M800"):
+		return 320
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,33 @@
+package qq
+
+import (
+	"context"
+
+	"github.com/winterssy/music-get/provider"
+)
+
+func init() {
+	provider.RegisterSearchFunc(provider.QQMusic, search)
+	provider.RegisterSongRequestFunc(provider.QQMusic, newSongRequest)
+}
+
+func search(ctx context.Context, keyword string, limit int) ([]*provider.SearchResult, error) {
+	req := NewSearchRequest(keyword, limit)
+	if err := req.Do(ctx); err != nil {
+		return nil, err
+	}
+
+	results := make([]*provider.SearchResult, 0, len(req.Response.Data.Song.List))
+	for _, i := range req.Response.Data.Song.List {
+		results = append(results, &provider.SearchResult{
+			Track:    i.resolve().Track,
+			Provider: provider.QQMusic,
+			Request:  NewSongRequest(i.Mid),
+		})
+	}
+	return results, nil
+}
+
+func newSongRequest(mid string) (provider.MusicRequest, error) {
+	return NewSongRequest(mid), nil
+}
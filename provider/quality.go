@@ -0,0 +1,37 @@
+package provider
+
+import (
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/winterssy/music-get/conf"
+)
+
+// Qualities returns the qualities to request in order, from the configured one down to the standard.
+func Qualities() []int {
+	qualities := make([]int, 0, int(conf.Conf.Quality)+1)
+	for q := int(conf.Conf.Quality); q >= conf.QualityStandard; q-- {
+		qualities = append(qualities, q)
+	}
+	return qualities
+}
+
+// SetExt replaces the extension of m.FileName with ext, such as "flac" or ".flac",
+// so that the file name follows the format actually delivered.
+func (m *MP3) SetExt(ext string) {
+	ext = strings.ToLower(strings.TrimPrefix(ext, "."))
+	if ext == "" {
+		return
+	}
+	m.FileName = strings.TrimSuffix(m.FileName, path.Ext(m.FileName)) + "." + ext
+}
+
+// ExtFromURL returns the file extension in the path of rawURL without the dot, such as "flac".
+func ExtFromURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(path.Ext(u.Path), ".")
+}
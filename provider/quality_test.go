@@ -0,0 +1,66 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/winterssy/music-get/conf"
+)
+
+func TestQualities(t *testing.T) {
+	defer func() {
+		conf.Conf.Quality = conf.QualityStandard
+	}()
+	tests := []struct {
+		quality conf.Quality
+		want    []int
+	}{
+		{conf.QualityStandard, []int{conf.QualityStandard}},
+		{conf.QualityHigh, []int{conf.QualityHigh, conf.QualityStandard}},
+		{conf.QualityLossless, []int{conf.QualityLossless, conf.QualityHigh, conf.QualityStandard}},
+	}
+	for _, test := range tests {
+		conf.Conf.Quality = test.quality
+		if got := Qualities(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Qualities of %s got %v, want %v", test.quality, got, test.want)
+		}
+	}
+}
+
+func TestMP3_SetExt(t *testing.T) {
+	tests := []struct {
+		fileName string
+		ext      string
+		want     string
+	}{
+		{"a.mp3", "flac", "a.flac"},
+		{"a.mp3", ".FLAC", "a.flac"},
+		{"a.mp3", "", "a.mp3"},
+		{"a", "m4a", "a.m4a"},
+		{"Mr. Big - 1.0.mp3", "ape", "Mr. Big - 1.0.ape"},
+	}
+	for _, test := range tests {
+		m := &MP3{FileName: test.fileName}
+		if m.SetExt(test.ext); m.FileName != test.want {
+			t.Errorf("SetExt(%q) of %q got %q, want %q", test.ext, test.fileName, m.FileName, test.want)
+		}
+	}
+}
+
+func TestExtFromURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://a.com/music/1.flac", "flac"},
+		{"http://a.com/music/1.mp3?vkey=a.b&guid=1", "mp3"},
+		{"http://a.com/music/1", ""},
+		{"http://a.com/", ""},
+		{"://invalid", ""},
+	}
+	for _, test := range tests {
+		if got := ExtFromURL(test.url); got != test.want {
+			t.Errorf("ExtFromURL(%q) got %q, want %q", test.url, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"sync"
+
+	"github.com/winterssy/music-get/conf"
+	"github.com/winterssy/music-get/pkg/ratelimit"
+)
+
+var (
+	bandwidth     *ratelimit.Bucket
+	bandwidthOnce sync.Once
+
+	hostLimiters   = make(map[string]*ratelimit.Bucket)
+	hostLimitersMu sync.Mutex
+)
+
+// limitBandwidth wraps r so that all downloads share the bandwidth of conf.Conf.LimitRate,
+// r is returned as is if there's no limit.
+func limitBandwidth(ctx context.Context, r io.Reader) io.Reader {
+	bandwidthOnce.Do(func() {
+		if rate := conf.Conf.LimitRate; rate > 0 {
+			bandwidth = ratelimit.NewBucket(float64(rate), int(rate))
+		}
+	})
+	if bandwidth == nil {
+		return r
+	}
+	return ratelimit.NewReader(ctx, r, bandwidth)
+}
+
+// WaitRateLimit blocks until an API request to the host of rawURL is allowed, or ctx is done.
+// The limit is configured in requests per second by platform name in conf.Conf.RateLimits, no limit by default.
+func WaitRateLimit(ctx context.Context, platform int, rawURL string) error {
+	rps := conf.Conf.RateLimits[PlatformName(platform)]
+	if rps <= 0 {
+		return nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("%d:%s", platform, u.Host)
+	hostLimitersMu.Lock()
+	limiter, ok := hostLimiters[key]
+	if !ok {
+		limiter = ratelimit.NewBucket(rps, 1)
+		hostLimiters[key] = limiter
+	}
+	hostLimitersMu.Unlock()
+
+	return limiter.Wait(ctx, 1)
+}
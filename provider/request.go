@@ -2,54 +2,97 @@ package provider
 
 import (
 	"math/rand"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
 	"sync"
 	"time"
 
+	"github.com/winterssy/easylog"
 	"github.com/winterssy/music-get/conf"
 	"github.com/winterssy/sreq"
 )
 
 var (
-	client *sreq.Client
-	once   sync.Once
+	clients   = make(map[int]*sreq.Client)
+	clientsMu sync.Mutex
 )
 
+// Client returns the HTTP client of the platform, each platform has its own
+// cookie jar, default headers, timeouts and proxy.
 func Client(platform int) *sreq.Client {
-	once.Do(func() {
-		client = sreq.New(nil)
-		switch platform {
-		case NetEaseMusic:
-			client.SetDefaultRequestOpts(
-				sreq.WithHeaders(sreq.Headers{
-					"Origin":  "https://music.163.com",
-					"Referer": "https://music.163.com",
-				}),
-				sreq.WithCookies(conf.Conf.Cookies...),
-			)
-		case QQMusic:
-			client.SetDefaultRequestOpts(
-				sreq.WithHeaders(sreq.Headers{
-					"Origin":  "https://c.y.qq.com",
-					"Referer": "https://c.y.qq.com",
-				}),
-			)
-		case KuwoMusic:
-			client.SetDefaultRequestOpts(
-				sreq.WithHeaders(sreq.Headers{
-					"Origin":  "http://www.kuwo.cn",
-					"Referer": "http://www.kuwo.cn",
-				}),
-			)
-		}
-		client.AddDefaultRequestOpts(
-			sreq.WithHeaders(sreq.Headers{
-				"User-Agent": chooseUserAgent(),
-			}),
-		)
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	client, ok := clients[platform]
+	if !ok {
+		client = newClient(platform)
+		clients[platform] = client
+	}
+	return client
+}
+
+func newClient(platform int) *sreq.Client {
+	jar, _ := cookiejar.New(nil)
+	timeout := conf.Conf.Timeout
+	transport := &http.Transport{
+		Proxy: proxyFunc(platform),
+		DialContext: (&net.Dialer{
+			Timeout:   timeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	client := sreq.New(&http.Client{
+		Transport: transport,
+		Jar:       jar,
 	})
+
+	headers := sreq.Headers{
+		"User-Agent": chooseUserAgent(),
+	}
+	switch platform {
+	case NetEaseMusic:
+		headers["Origin"] = "https://music.163.com"
+		headers["Referer"] = "https://music.163.com"
+		if u, err := url.Parse("https://music.163.com"); err == nil {
+			jar.SetCookies(u, conf.Conf.Cookies)
+		}
+	case QQMusic:
+		headers["Origin"] = "https://c.y.qq.com"
+		headers["Referer"] = "https://c.y.qq.com"
+	case KuwoMusic:
+		headers["Origin"] = "http://www.kuwo.cn"
+		headers["Referer"] = "http://www.kuwo.cn"
+	}
+	client.SetDefaultRequestOpts(sreq.WithHeaders(headers))
 	return client
 }
 
+// proxyFunc returns the proxy of the platform, the platform specific proxy in config
+// takes precedence over the -proxy option, fallback to the environment variables.
+func proxyFunc(platform int) func(*http.Request) (*url.URL, error) {
+	proxy := conf.Conf.Proxy
+	if p, ok := conf.Conf.Proxies[PlatformName(platform)]; ok {
+		proxy = p
+	}
+	if proxy == "" {
+		return http.ProxyFromEnvironment
+	}
+
+	u, err := url.Parse(proxy)
+	if err != nil {
+		easylog.Warnf("Invalid proxy %q, use environment variables: %s", proxy, err.Error())
+		return http.ProxyFromEnvironment
+	}
+	return http.ProxyURL(u)
+}
+
 func chooseUserAgent() string {
 	var userAgentList = []string{
 		"Mozilla/5.0 (iPhone; CPU iPhone OS 9_1 like Mac OS X) AppleWebKit/601.1.46 (KHTML, like Gecko) Version/9.0 Mobile/13B143 Safari/601.1",
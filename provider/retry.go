@@ -0,0 +1,118 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/winterssy/easylog"
+	"github.com/winterssy/music-get/conf"
+	"github.com/winterssy/sreq"
+)
+
+const (
+	// MaxRetryWait is the upper limit of the wait time between two attempts
+	MaxRetryWait = 30 * time.Second
+)
+
+var (
+	jitter   = rand.New(rand.NewSource(time.Now().UnixNano()))
+	jitterMu sync.Mutex
+)
+
+// Retry calls f until it returns a response which should not be retried or the attempts run out,
+// transient errors such as connection resets, 5xx and 429 responses would be retried with exponential backoff.
+// The response of the last attempt is returned, the wait is aborted if ctx is done.
+func Retry(ctx context.Context, f func() *sreq.Response) *sreq.Response {
+	for attempt := 1; ; attempt++ {
+		resp := f()
+		if attempt >= conf.Conf.RetryAttempts || !retryable(resp) {
+			return resp
+		}
+
+		wait := backoff(attempt)
+		if resp.Err == nil {
+			if d, ok := retryAfter(resp.R); ok {
+				wait = d
+			}
+			resp.R.Body.Close()
+			easylog.Debugf("Request status %d, retry in %s (%d/%d): %s",
+				resp.R.StatusCode, wait, attempt, conf.Conf.RetryAttempts, resp.R.Request.URL)
+		} else {
+			easylog.Debugf("Request error: %s, retry in %s (%d/%d)",
+				resp.Err.Error(), wait, attempt, conf.Conf.RetryAttempts)
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return &sreq.Response{Err: err}
+		}
+	}
+}
+
+func retryable(resp *sreq.Response) bool {
+	if resp.Err != nil {
+		return temporary(resp.Err)
+	}
+	code := resp.R.StatusCode
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// temporary reports whether err is a transient network error worth retrying.
+func temporary(err error) bool {
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && (netErr.Timeout() || netErr.Temporary())
+}
+
+// backoff returns the wait time before the next attempt, it doubles every attempt
+// and is randomized into [d/2, d) to avoid concurrent requests retrying at the same time.
+func backoff(attempt int) time.Duration {
+	d := time.Duration(conf.Conf.RetryWait)
+	for i := 1; i < attempt && d < MaxRetryWait; i++ {
+		d *= 2
+	}
+	if d > MaxRetryWait {
+		d = MaxRetryWait
+	}
+	if d/2 <= 0 {
+		return d
+	}
+
+	jitterMu.Lock()
+	defer jitterMu.Unlock()
+	return d/2 + time.Duration(jitter.Int63n(int64(d/2)))
+}
+
+// sleep pauses for d, it returns the error of ctx if ctx is done before.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// retryAfter parses the Retry-After header in seconds.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	d := time.Duration(seconds) * time.Second
+	if d > MaxRetryWait {
+		d = MaxRetryWait
+	}
+	return d, true
+}
@@ -0,0 +1,145 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/winterssy/music-get/conf"
+	"github.com/winterssy/sreq"
+)
+
+func testResponse(code int, header http.Header) *sreq.Response {
+	req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1", nil)
+	return &sreq.Response{R: &http.Response{
+		StatusCode: code,
+		Header:     header,
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		resp *sreq.Response
+		want bool
+	}{
+		{testResponse(http.StatusOK, nil), false},
+		{testResponse(http.StatusNotFound, nil), false},
+		{testResponse(http.StatusForbidden, nil), false},
+		{testResponse(http.StatusTooManyRequests, nil), true},
+		{testResponse(http.StatusInternalServerError, nil), true},
+		{testResponse(http.StatusBadGateway, nil), true},
+		{testResponse(http.StatusServiceUnavailable, nil), true},
+		{&sreq.Response{Err: &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}}, true},
+		{&sreq.Response{Err: &net.DNSError{Err: "timeout", IsTimeout: true}}, true},
+		{&sreq.Response{Err: io.ErrUnexpectedEOF}, true},
+		{&sreq.Response{Err: &net.DNSError{Err: "no such host", IsNotFound: true}}, false},
+		{&sreq.Response{Err: context.Canceled}, false},
+		{&sreq.Response{Err: errors.New("unsupported protocol scheme")}, false},
+	}
+	for i, test := range tests {
+		if got := retryable(test.resp); got != test.want {
+			t.Errorf("retryable of case %d got %v, want %v", i, got, test.want)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{"0", 0, true},
+		{"-1", 0, false},
+		{"3600", MaxRetryWait, true},
+		{"Wed, 21 Oct 2015 07:28:00 GMT", 0, false},
+	}
+	for _, test := range tests {
+		resp := testResponse(http.StatusTooManyRequests, http.Header{"Retry-After": {test.value}})
+		if got, ok := retryAfter(resp.R); got != test.want || ok != test.ok {
+			t.Errorf("retryAfter(%q) got %s, %v, want %s, %v", test.value, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	conf.Conf.RetryWait = conf.Duration(time.Second)
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{1, 500 * time.Millisecond, time.Second},
+		{2, time.Second, 2 * time.Second},
+		{3, 2 * time.Second, 4 * time.Second},
+		{10, MaxRetryWait / 2, MaxRetryWait},
+	}
+	for _, test := range tests {
+		for i := 0; i < 100; i++ {
+			if got := backoff(test.attempt); got < test.min || got >= test.max {
+				t.Fatalf("backoff(%d) got %s, want in [%s, %s)", test.attempt, got, test.min, test.max)
+			}
+		}
+	}
+
+	conf.Conf.RetryWait = 0
+	if got := backoff(3); got != 0 {
+		t.Errorf("backoff without wait got %s", got)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	conf.Conf.RetryWait = conf.Duration(time.Millisecond)
+	conf.Conf.RetryAttempts = 3
+	defer func() {
+		conf.Conf.RetryWait, conf.Conf.RetryAttempts = 0, 0
+	}()
+
+	tests := []struct {
+		codes []int
+		calls int
+		want  int
+	}{
+		{[]int{http.StatusOK}, 1, http.StatusOK},
+		{[]int{http.StatusNotFound}, 1, http.StatusNotFound},
+		{[]int{http.StatusBadGateway, http.StatusOK}, 2, http.StatusOK},
+		{[]int{http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusOK}, 3, http.StatusOK},
+		// the response of the last attempt is returned after the attempts run out
+		{[]int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusOK}, 3, http.StatusBadGateway},
+	}
+	for _, test := range tests {
+		calls := 0
+		resp := Retry(context.Background(), func() *sreq.Response {
+			calls++
+			return testResponse(test.codes[calls-1], nil)
+		})
+		if calls != test.calls || resp.R.StatusCode != test.want {
+			t.Errorf("Retry of %v got %d calls and status %d, want %d calls and status %d",
+				test.codes, calls, resp.R.StatusCode, test.calls, test.want)
+		}
+	}
+
+	// the wait is aborted once ctx is done
+	ctx, cancel := context.WithCancel(context.Background())
+	conf.Conf.RetryWait = conf.Duration(time.Hour)
+	calls := 0
+	resp := Retry(ctx, func() *sreq.Response {
+		calls++
+		cancel()
+		return testResponse(http.StatusBadGateway, nil)
+	})
+	if calls != 1 || !errors.Is(resp.Err, context.Canceled) {
+		t.Errorf("Retry with canceled context got %d calls, %v", calls, resp.Err)
+	}
+}
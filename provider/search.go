@@ -0,0 +1,55 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+const (
+	DefaultSearchLimit = 10
+)
+
+type (
+	// SearchFunc searches songs by keyword on a platform, at most limit results in relevance order.
+	SearchFunc func(ctx context.Context, keyword string, limit int) ([]*SearchResult, error)
+
+	// SearchResult is a song matched by the search keyword.
+	SearchResult struct {
+		Track    *Track
+		Provider int
+		// Request fetches the song so that it can be prepared and downloaded as usual
+		Request MusicRequest
+	}
+)
+
+var (
+	// ErrSearchUnsupported is returned when searching on a platform without search support
+	ErrSearchUnsupported = errors.New("search unsupported")
+
+	searchFuncs = make(map[int]SearchFunc)
+)
+
+// RegisterSearchFunc registers the search function of a platform, it should be called in init.
+func RegisterSearchFunc(platform int, f SearchFunc) {
+	searchFuncs[platform] = f
+}
+
+// Search searches songs by keyword on the platform.
+func Search(ctx context.Context, platform int, keyword string, limit int) ([]*SearchResult, error) {
+	f, ok := searchFuncs[platform]
+	if !ok {
+		return nil, ErrSearchUnsupported
+	}
+	return f(ctx, keyword, limit)
+}
+
+// SearchPlatforms returns the platforms supporting search in order.
+func SearchPlatforms() []int {
+	platforms := make([]int, 0, len(searchFuncs))
+	for k := range searchFuncs {
+		platforms = append(platforms, k)
+	}
+	sort.Ints(platforms)
+	return platforms
+}
@@ -0,0 +1,32 @@
+package provider
+
+import (
+	"errors"
+)
+
+type (
+	// SongRequestFunc creates the request of a single song by its track id.
+	SongRequestFunc func(id string) (MusicRequest, error)
+)
+
+var (
+	// ErrSongRequestUnsupported is returned when requesting a song by id on an unknown platform
+	ErrSongRequestUnsupported = errors.New("song request unsupported")
+
+	songRequestFuncs = make(map[int]SongRequestFunc)
+)
+
+// RegisterSongRequestFunc registers the song request creator of a platform, it should be called in init.
+func RegisterSongRequestFunc(platform int, f SongRequestFunc) {
+	songRequestFuncs[platform] = f
+}
+
+// NewSongRequest creates the request of a single song by the platform and its track id,
+// so that the song can be resolved again, such as its download url expires.
+func NewSongRequest(platform int, id string) (MusicRequest, error) {
+	f, ok := songRequestFuncs[platform]
+	if !ok {
+		return nil, ErrSongRequestUnsupported
+	}
+	return f(id)
+}
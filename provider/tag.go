@@ -0,0 +1,80 @@
+package provider
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+
+	"github.com/winterssy/easylog"
+	"github.com/winterssy/music-get/conf"
+	"github.com/winterssy/music-get/pkg/id3v2"
+	"github.com/winterssy/music-get/pkg/mp4meta"
+)
+
+func (m *MP3) embedTag(ctx context.Context, fPath string) error {
+	if !conf.Conf.EmbedTag || m.Track == nil {
+		return nil
+	}
+
+	switch strings.ToLower(filepath.Ext(fPath)) {
+	case ".mp3":
+		return m.writeID3v2(ctx, fPath)
+	case ".m4a", ".mp4":
+		return m.writeMP4Meta(ctx, fPath)
+	default:
+		easylog.Debugf("Embed tag: unsupported file format: %s", m.FileName)
+		return nil
+	}
+}
+
+func (m *MP3) writeID3v2(ctx context.Context, fPath string) error {
+	tag, err := id3v2.NewTag(byte(conf.Conf.ID3v2Version))
+	if err != nil {
+		return err
+	}
+
+	tag.SetTitle(m.Track.Title)
+	tag.SetArtists(m.Track.Artists...)
+	tag.SetAlbum(m.Track.Album)
+	tag.SetAlbumArtist(m.Track.AlbumArtistOrDefault())
+	tag.SetTrackNumber(m.Track.TrackNumber, 0)
+	tag.SetDiscNumber(m.Track.DiscNumber, 0)
+	tag.SetYear(m.Track.Year())
+	if cover := m.cover(ctx); len(cover) > 0 {
+		tag.SetPicture(id3v2.PictureTypeFrontCover, "", cover)
+	}
+	if !m.lyrics.Empty() {
+		texts := make([]id3v2.SyncedText, 0, len(m.lyrics.Lines))
+		for _, i := range m.lyrics.Lines {
+			texts = append(texts, id3v2.SyncedText{Text: i.Text, Timestamp: i.Time})
+			if i.Translation != "" {
+				texts = append(texts, id3v2.SyncedText{Text: i.Translation, Timestamp: i.Time})
+			}
+		}
+		tag.SetLyrics("", "", m.lyrics.Text())
+		tag.SetSyncedLyrics("", "", texts)
+	}
+
+	easylog.Debugf("Write ID3v2.%d tag: %s", tag.Version(), m.FileName)
+	return id3v2.WriteFile(fPath, tag)
+}
+
+func (m *MP3) writeMP4Meta(ctx context.Context, fPath string) error {
+	tag := mp4meta.NewTag()
+	tag.SetTitle(m.Track.Title)
+	tag.SetArtists(m.Track.Artists...)
+	tag.SetAlbum(m.Track.Album)
+	tag.SetAlbumArtist(m.Track.AlbumArtistOrDefault())
+	tag.SetTrackNumber(m.Track.TrackNumber, 0)
+	tag.SetDiscNumber(m.Track.DiscNumber, 0)
+	tag.SetYear(m.Track.Year())
+	if cover := m.cover(ctx); len(cover) > 0 {
+		tag.SetPicture(cover)
+	}
+	if !m.lyrics.Empty() {
+		tag.SetLyrics(m.lyrics.Text())
+	}
+
+	easylog.Debugf("Write MP4 metadata: %s", m.FileName)
+	return mp4meta.WriteFile(fPath, tag)
+}
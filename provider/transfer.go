@@ -0,0 +1,197 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"github.com/winterssy/easylog"
+	"github.com/winterssy/music-get/conf"
+	"github.com/winterssy/music-get/internal/ecode"
+	"github.com/winterssy/sreq"
+)
+
+const (
+	PartFileExt = ".part"
+	PartMetaExt = ".part.json"
+)
+
+type (
+	// ProgressFunc wraps the response body to report the transfer progress,
+	// current is the size already downloaded before, total is -1 if unknown.
+	ProgressFunc func(r io.Reader, current, total int64) io.Reader
+
+	// partMeta is saved alongside the .part file to validate whether it can be resumed.
+	partMeta struct {
+		ETag   string `json:"etag,omitempty"`
+		Length int64  `json:"length"`
+	}
+)
+
+// transfer downloads m into fPath through a .part file, resuming the previous partial download
+// if the server supports range requests. fPath appears only after the transfer completes.
+// An interrupted transfer would be retried according to the retry policy, while a canceled one
+// removes the partial files since it's not expected to be resumed.
+func (m *MP3) transfer(ctx context.Context, fPath string, progress ProgressFunc) (status int) {
+	defer func() {
+		if ctx.Err() != nil && status != ecode.Success {
+			os.Remove(fPath + PartFileExt)
+			os.Remove(fPath + PartMetaExt)
+			status = ecode.DownloadCanceled
+		}
+	}()
+
+	for attempt := 1; ; attempt++ {
+		status = m.transferOnce(ctx, fPath, progress)
+		if status != ecode.FileTransferException || attempt >= conf.Conf.RetryAttempts {
+			return
+		}
+
+		wait := backoff(attempt)
+		easylog.Debugf("Download interrupted, retry in %s (%d/%d): %s",
+			wait, attempt, conf.Conf.RetryAttempts, m.FileName)
+		if sleep(ctx, wait) != nil {
+			return
+		}
+	}
+}
+
+func (m *MP3) transferOnce(ctx context.Context, fPath string, progress ProgressFunc) int {
+	partPath, metaPath := fPath+PartFileExt, fPath+PartMetaExt
+
+	var offset int64
+	meta, err := loadPartMeta(metaPath)
+	if err == nil {
+		if fi, err := os.Stat(partPath); err == nil {
+			offset = fi.Size()
+		}
+	}
+
+	headers := sreq.Headers{}
+	if offset > 0 {
+		easylog.Debugf("Resume download from %d bytes: %s", offset, m.FileName)
+		headers["Range"] = fmt.Sprintf("bytes=%d-", offset)
+		if meta.ETag != "" {
+			headers["If-Range"] = meta.ETag
+		}
+	}
+
+	resp, err := Retry(ctx, func() *sreq.Response {
+		return Client(m.Provider).Get(m.DownloadURL, sreq.WithHeaders(headers), sreq.WithContext(ctx))
+	}).Resolve()
+	if err != nil {
+		return ecode.HTTPRequestException
+	}
+	defer resp.Body.Close()
+
+	// a range response is unexpected without a range request
+	if offset == 0 && resp.StatusCode != http.StatusOK {
+		easylog.Debugf("Download status error: %d", resp.StatusCode)
+		return ecode.HTTPRequestException
+	}
+
+	flag, total := os.O_CREATE|os.O_WRONLY|os.O_TRUNC, resp.ContentLength
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, length := parseContentRange(resp.Header.Get("Content-Range"))
+		if start != offset || (length >= 0 && length != meta.Length) {
+			easylog.Debugf("Partial file outdated, restart download: %s", m.FileName)
+			return m.restartTransfer(ctx, fPath, progress, resp)
+		}
+		flag, total = os.O_WRONLY|os.O_APPEND, meta.Length
+	case http.StatusOK:
+		// the server ignores the range or the resource has changed
+		offset = 0
+		if resp.Header.Get("Accept-Ranges") == "bytes" && total > 0 {
+			meta = &partMeta{ETag: resp.Header.Get("ETag"), Length: total}
+			if err = savePartMeta(metaPath, meta); err != nil {
+				easylog.Debugf("Save partial file meta failed: %s", err.Error())
+			}
+		} else {
+			os.Remove(metaPath)
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		if offset == meta.Length {
+			return finishTransfer(partPath, metaPath, fPath)
+		}
+		return m.restartTransfer(ctx, fPath, progress, resp)
+	default:
+		easylog.Debugf("Download status error: %d", resp.StatusCode)
+		return ecode.HTTPRequestException
+	}
+
+	f, err := os.OpenFile(partPath, flag, 0644)
+	if err != nil {
+		return ecode.BuildFileException
+	}
+
+	r := limitBandwidth(ctx, resp.Body)
+	if progress != nil {
+		r = progress(r, offset, total)
+	}
+	n, err := io.Copy(f, r)
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	// the length is -1 if unknown, the content is verified after the transfer then
+	if err != nil || (resp.ContentLength >= 0 && n != resp.ContentLength) {
+		return ecode.FileTransferException
+	}
+
+	return finishTransfer(partPath, metaPath, fPath)
+}
+
+func (m *MP3) restartTransfer(ctx context.Context, fPath string, progress ProgressFunc, resp *http.Response) int {
+	resp.Body.Close()
+	os.Remove(fPath + PartFileExt)
+	// without meta the next transfer always starts from zero
+	os.Remove(fPath + PartMetaExt)
+	return m.transferOnce(ctx, fPath, progress)
+}
+
+// finishTransfer renames the completed .part file to its final path atomically.
+func finishTransfer(partPath, metaPath, fPath string) int {
+	if err := os.Rename(partPath, fPath); err != nil {
+		return ecode.BuildFileException
+	}
+	os.Remove(metaPath)
+	return ecode.Success
+}
+
+// parseContentRange parses "bytes 100-999/1000" and returns the start and the complete length,
+// the complete length is -1 if it's unknown.
+func parseContentRange(s string) (start, length int64) {
+	start, length = -1, -1
+	var end int64
+	if _, err := fmt.Sscanf(s, "bytes %d-%d/%d", &start, &end, &length); err != nil {
+		if _, err = fmt.Sscanf(s, "bytes %d-%d/*", &start, &end); err != nil {
+			return -1, -1
+		}
+	}
+	return
+}
+
+func loadPartMeta(metaPath string) (*partMeta, error) {
+	data, err := ioutil.ReadFile(metaPath)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := new(partMeta)
+	if err = json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+func savePartMeta(metaPath string, meta *partMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(metaPath, data, 0644)
+}
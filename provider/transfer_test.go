@@ -0,0 +1,188 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/winterssy/music-get/conf"
+	"github.com/winterssy/music-get/internal/ecode"
+	"github.com/winterssy/music-get/utils"
+)
+
+const (
+	transferContent = "0123456789"
+)
+
+// serveContent serves transferContent with the etag, range requests are supported.
+func serveContent(etag string, requests *[]*http.Request) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		*requests = append(*requests, r)
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader([]byte(transferContent)))
+	}
+}
+
+func testDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "music-get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// testTransfer transfers the file served by handler into dir, with the partial file and its meta created before.
+func testTransfer(t *testing.T, dir string, handler http.Handler, part string, meta *partMeta) (status int, fPath string) {
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+	conf.Conf.RetryAttempts = 1
+
+	fPath = filepath.Join(dir, "a.mp3")
+	if part != "" {
+		if err := ioutil.WriteFile(fPath+PartFileExt, []byte(part), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if meta != nil {
+		if err := savePartMeta(fPath+PartMetaExt, meta); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := &MP3{FileName: "a.mp3", DownloadURL: srv.URL, Provider: NetEaseMusic}
+	status = m.transfer(context.Background(), fPath, nil)
+	return
+}
+
+func assertTransferred(t *testing.T, fPath string) {
+	t.Helper()
+	data, err := ioutil.ReadFile(fPath)
+	if err != nil || string(data) != transferContent {
+		t.Errorf("transfer got %q, %v, want %q", data, err, transferContent)
+	}
+	for _, ext := range []string{PartFileExt, PartMetaExt} {
+		if exists, _ := utils.ExistsPath(fPath + ext); exists {
+			t.Errorf("%s should be removed after the transfer", ext)
+		}
+	}
+}
+
+func TestTransfer_Resume(t *testing.T) {
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+	var requests []*http.Request
+	status, fPath := testTransfer(t, dir, serveContent(`"v1"`, &requests), "01234", &partMeta{ETag: `"v1"`, Length: 10})
+	if status != ecode.Success {
+		t.Fatalf("transfer got status %d", status)
+	}
+	assertTransferred(t, fPath)
+	if len(requests) != 1 || requests[0].Header.Get("Range") != "bytes=5-" || requests[0].Header.Get("If-Range") != `"v1"` {
+		t.Errorf("transfer should resume with a single range request, got %d requests", len(requests))
+	}
+}
+
+func TestTransfer_RangeIgnored(t *testing.T) {
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+	var requests []*http.Request
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		io.WriteString(w, transferContent)
+	}
+	status, fPath := testTransfer(t, dir, http.HandlerFunc(handler), "xxxxx", &partMeta{Length: 10})
+	if status != ecode.Success {
+		t.Fatalf("transfer got status %d", status)
+	}
+	// the partial file is overwritten instead of appended
+	assertTransferred(t, fPath)
+	if len(requests) != 1 || requests[0].Header.Get("Range") != "bytes=5-" {
+		t.Errorf("transfer got %d requests", len(requests))
+	}
+}
+
+func TestTransfer_RangeNotSatisfiable(t *testing.T) {
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+	var requests []*http.Request
+	status, fPath := testTransfer(t, dir, serveContent(`"v1"`, &requests), transferContent, &partMeta{ETag: `"v1"`, Length: 10})
+	if status != ecode.Success {
+		t.Fatalf("transfer got status %d", status)
+	}
+	// the complete partial file is renamed without downloading again
+	assertTransferred(t, fPath)
+	if len(requests) != 1 {
+		t.Errorf("transfer got %d requests, want 1", len(requests))
+	}
+}
+
+func TestTransfer_Restart(t *testing.T) {
+	tests := []struct {
+		name     string
+		meta     *partMeta
+		requests int
+	}{
+		// If-Range mismatches, the server responds the whole content
+		{"etag changed", &partMeta{ETag: `"v0"`, Length: 10}, 1},
+		// the partial file belongs to an older version of different length
+		{"length changed", &partMeta{Length: 20}, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := testDir(t)
+			defer os.RemoveAll(dir)
+			var requests []*http.Request
+			status, fPath := testTransfer(t, dir, serveContent(`"v1"`, &requests), "abcde", test.meta)
+			if status != ecode.Success {
+				t.Fatalf("transfer got status %d", status)
+			}
+			assertTransferred(t, fPath)
+			if len(requests) != test.requests {
+				t.Errorf("transfer got %d requests, want %d", len(requests), test.requests)
+			}
+			if last := requests[len(requests)-1]; test.requests > 1 && last.Header.Get("Range") != "" {
+				t.Errorf("transfer should restart without range, got %q", last.Header.Get("Range"))
+			}
+		})
+	}
+}
+
+func TestTransfer_Interrupted(t *testing.T) {
+	var fPath string
+	var existsDuring bool
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Length", "10")
+		io.WriteString(w, transferContent[:5])
+		w.(http.Flusher).Flush()
+		existsDuring, _ = utils.ExistsPath(fPath)
+		// the connection is closed before the whole content is written
+	}
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+	srv := httptest.NewServer(http.HandlerFunc(handler))
+	defer srv.Close()
+	conf.Conf.RetryAttempts = 1
+
+	fPath = filepath.Join(dir, "a.mp3")
+	m := &MP3{FileName: "a.mp3", DownloadURL: srv.URL, Provider: NetEaseMusic}
+	if status := m.transfer(context.Background(), fPath, nil); status != ecode.FileTransferException {
+		t.Fatalf("transfer got status %d, want %d", status, ecode.FileTransferException)
+	}
+	if exists, _ := utils.ExistsPath(fPath); exists || existsDuring {
+		t.Error("the final file should not exist before the transfer completes")
+	}
+	if data, err := ioutil.ReadFile(fPath + PartFileExt); err != nil || string(data) != transferContent[:5] {
+		t.Errorf("partial file got %q, %v", data, err)
+	}
+	if meta, err := loadPartMeta(fPath + PartMetaExt); err != nil || meta.ETag != `"v1"` || meta.Length != 10 {
+		t.Errorf("partial file meta got %+v, %v", meta, err)
+	}
+}
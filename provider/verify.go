@@ -0,0 +1,43 @@
+package provider
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/winterssy/easylog"
+	"github.com/winterssy/music-get/pkg/audio"
+)
+
+const (
+	// MinDurationGap is the least gap regarded as shorter than the duration reported by the provider,
+	// the gap is also at least 10% of the reported duration
+	MinDurationGap = 10 * time.Second
+)
+
+// verify probes the downloaded file, it fails if the file isn't audio, such as an HTML error page,
+// is truncated, or is much shorter than the duration reported by the provider, such as a preview clip.
+func (m *MP3) verify(fPath string) error {
+	info, err := audio.ProbeFile(fPath)
+	if err != nil {
+		return err
+	}
+
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(fPath), "."))
+	if ext != info.Format && !(ext == "mp4" && info.Format == audio.FormatM4A) {
+		easylog.Debugf("Format mismatch: %s: %s", m.FileName, info.Format)
+	}
+
+	if m.Track == nil || m.Track.Duration <= 0 || info.Duration <= 0 {
+		return nil
+	}
+	gap := m.Track.Duration / 10
+	if gap < MinDurationGap {
+		gap = MinDurationGap
+	}
+	if m.Track.Duration-info.Duration >= gap {
+		return fmt.Errorf("duration %s is shorter than %s", info.Duration.Round(time.Second), m.Track.Duration)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"path/filepath"
+
+	"github.com/winterssy/easylog"
+	"github.com/winterssy/music-get/conf"
+	"github.com/winterssy/music-get/handler"
+	"github.com/winterssy/music-get/provider"
+)
+
+// retry runs "music-get retry [report-file] [-force]", the failed tracks of the report,
+// or of the log file by default, are re-resolved from their providers and downloaded again.
+func retry(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet(RetryCommand, flag.ExitOnError)
+	force := fs.Bool("force", false, "retry the unavailable songs too")
+
+	files := make([]string, 0)
+	for {
+		if err := fs.Parse(args); err != nil {
+			easylog.Fatal(err)
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		files = append(files, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	var name string
+	switch len(files) {
+	case 0:
+		name = filepath.Join(conf.Conf.Workspace, handler.LogFileName)
+	case 1:
+		name = files[0]
+	default:
+		easylog.Fatal("Too many report files")
+	}
+
+	easylog.Debugf("Read report from %q", name)
+	records, err := handler.ReadReport(name)
+	if err != nil {
+		easylog.Fatalf("Read report failed: %s", err.Error())
+	}
+
+	records = handler.RetryRecords(records, *force)
+	if len(records) == 0 {
+		easylog.Info("Nothing to retry")
+		return
+	}
+
+	reqs := make([]provider.MusicRequest, 0, len(records))
+	for _, i := range records {
+		req, err := handler.NewRetryRequest(i)
+		if err != nil {
+			easylog.Errorf("Retry failed: %s: %s", i.Path, err.Error())
+			continue
+		}
+		reqs = append(reqs, req)
+	}
+
+	if conf.Conf.ReportFile == "" {
+		conf.Conf.ReportFile = handler.RetryReportFile(name)
+	}
+	// the songs are saved to the paths of the records, which are named already
+	conf.Conf.OutputTemplate = ""
+	run(ctx, reqs)
+}
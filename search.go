@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/winterssy/easylog"
+	"github.com/winterssy/music-get/handler"
+	"github.com/winterssy/music-get/provider"
+)
+
+// search runs "music-get search <keywords> [-p netease,qq,...] [-limit 10]",
+// options may follow the keywords.
+func search(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet(SearchCommand, flag.ExitOnError)
+	platformsOpt := fs.String("p", "", "search on the specified platforms, comma separated, such as netease,qq, all by default")
+	limit := fs.Int("limit", provider.DefaultSearchLimit, "max results of each platform")
+
+	keywords := make([]string, 0)
+	for {
+		if err := fs.Parse(args); err != nil {
+			easylog.Fatal(err)
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		keywords = append(keywords, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	keyword := strings.TrimSpace(strings.Join(keywords, " "))
+	if keyword == "" {
+		easylog.Fatal("Missing search keywords")
+	}
+	if *limit < 1 {
+		easylog.Warn("Invalid limit parameter, use default value")
+		*limit = provider.DefaultSearchLimit
+	}
+
+	platforms := provider.SearchPlatforms()
+	if *platformsOpt != "" {
+		var err error
+		if platforms, err = handler.ParsePlatforms(strings.Split(*platformsOpt, ",")); err != nil {
+			easylog.Fatal(err)
+		}
+	}
+
+	results := handler.Search(ctx, keyword, platforms, *limit)
+	if len(results) == 0 {
+		easylog.Info("No results found")
+		return
+	}
+	handler.PrintSearchResults(os.Stdout, results)
+
+	fmt.Print("\nSelect songs to download (e.g. 1 3 5-7, all), empty to quit: ")
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	indexes, err := handler.ParseSelection(line, len(results))
+	if err != nil {
+		easylog.Fatal(err)
+	}
+
+	reqs := make([]provider.MusicRequest, 0, len(indexes))
+	for _, i := range indexes {
+		reqs = append(reqs, results[i].Request)
+	}
+	run(ctx, reqs)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/winterssy/easylog"
+	"github.com/winterssy/music-get/conf"
+	"github.com/winterssy/music-get/handler"
+	"github.com/winterssy/music-get/provider"
+)
+
+// syncPlaylist runs "music-get sync <playlist-url> [-removed keep|move|delete]", only the songs new to
+// the playlist are downloaded, matched by the manifest in the playlist directory, then the removed songs
+// are handled and the playlist files are rewritten.
+func syncPlaylist(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet(SyncCommand, flag.ExitOnError)
+	removed := fs.String("removed", handler.SyncKeep, "the songs removed from the playlist are kept, moved into "+
+		handler.SyncRemovedDir+" (move) or deleted (delete)")
+
+	urls := make([]string, 0)
+	for {
+		if err := fs.Parse(args); err != nil {
+			easylog.Fatal(err)
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		urls = append(urls, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	switch *removed {
+	case handler.SyncKeep, handler.SyncMove, handler.SyncDelete:
+	default:
+		easylog.Fatalf("Invalid removed parameter: %s", *removed)
+	}
+	if len(urls) != 1 {
+		easylog.Fatal("Require exactly one playlist address")
+	}
+
+	req, err := handler.Parse(urls[0])
+	if err != nil {
+		easylog.Fatalf("Parse music address failed: %s: %s", urls[0], err.Error())
+	}
+	c, ok := req.(provider.Collection)
+	if !ok {
+		easylog.Fatalf("Not a playlist or album: %s", urls[0])
+	}
+
+	tmpl := outputTemplate()
+	login([]provider.MusicRequest{req})
+	if err = req.Do(ctx); err != nil {
+		easylog.Fatal(err)
+	}
+	mp3List, err := req.Prepare(ctx)
+	if err != nil {
+		easylog.Fatal(err)
+	}
+	if len(mp3List) == 0 {
+		easylog.Info("Empty playlist")
+		return
+	}
+
+	playlist := handler.NewPlaylist(c.CollectionName(), mp3List)
+	dir := filepath.Join(conf.Conf.DownloadDir, playlist.Dir)
+	manifest, err := handler.LoadSyncManifest(dir)
+	if err != nil {
+		easylog.Fatalf("Load sync manifest failed: %s", err.Error())
+	}
+	manifest.Title, manifest.URL = playlist.Title, urls[0]
+
+	plan := manifest.Plan(dir, mp3List)
+	newSongs := handler.MergeMP3List(plan.Download)
+	resolve(ctx, newSongs, tmpl)
+
+	if conf.Conf.DryRun {
+		if err = handler.PrintMP3List(os.Stdout, newSongs, conf.Conf.JSONOutput); err != nil {
+			easylog.Error(err)
+		}
+		if conf.Conf.JSONOutput {
+			return
+		}
+		paths := make([]string, 0, len(plan.Removed))
+		for _, e := range plan.Removed {
+			paths = append(paths, filepath.Join(dir, filepath.FromSlash(e.Path)))
+		}
+		sort.Strings(paths)
+		for _, i := range paths {
+			fmt.Printf("%-11s  %s\n", "removed", i)
+		}
+		fmt.Printf("Sync --> %s: new: %d, unchanged: %d, removed: %d\n",
+			playlist.Title, len(newSongs), len(plan.Kept), len(plan.Removed))
+		return
+	}
+
+	easylog.Infof("Sync: %s: new: %d, unchanged: %d, removed: %d",
+		playlist.Title, len(newSongs), len(plan.Kept), len(plan.Removed))
+
+	tasks := plan.Kept
+	if len(newSongs) > 0 {
+		tasks = append(tasks, handler.Download(ctx, newSongs, conf.Conf.ConcurrentDownloadTasksCount)...)
+	}
+	manifest.Update(dir, tasks)
+
+	// the removal is skipped if interrupted, since the playlist may be partially handled
+	if ctx.Err() == nil {
+		paths, err := manifest.Remove(dir, plan.Removed, *removed)
+		for _, i := range paths {
+			easylog.Infof("Removed from playlist (%s): %s", *removed, i)
+		}
+		if err != nil {
+			easylog.Error(err)
+		}
+	}
+
+	if err = manifest.Save(dir); err != nil {
+		easylog.Errorf("Save sync manifest failed: %s", err.Error())
+	}
+	handler.SavePlaylists([]*handler.Playlist{playlist}, tasks, conf.Conf.PlaylistFormats)
+}
@@ -2,8 +2,6 @@ package utils
 
 import (
 	"os"
-	"regexp"
-	"strings"
 )
 
 func ExistsPath(path string) (bool, error) {
@@ -25,8 +23,8 @@ func BuildPathIfNotExist(path string) error {
 	return err
 }
 
+// TrimInvalidFilePathChars sanitizes a file or directory name with the sanitizer set by SetSanitizer,
+// the profile of the build OS by default.
 func TrimInvalidFilePathChars(path string) string {
-	path = strings.TrimSpace(path)
-	re := regexp.MustCompile(Pattern)
-	return re.ReplaceAllString(path, "")
+	return defaultSanitizer.Sanitize(path)
 }
@@ -1,7 +0,0 @@
-// +build darwin
-
-package utils
-
-const (
-	Pattern = `[:/]`
-)
@@ -1,7 +0,0 @@
-// +build linux
-
-package utils
-
-const (
-	Pattern = `/`
-)
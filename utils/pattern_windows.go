@@ -1,7 +0,0 @@
-// +build windows
-
-package utils
-
-const (
-	Pattern = `[\\/:*?"<>|]`
-)
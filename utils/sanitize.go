@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Profiles of the file name rules, portable is the strictest, accepted by all.
+const (
+	ProfilePosix    = "posix"
+	ProfileMacOS    = "macos"
+	ProfileWindows  = "windows"
+	ProfilePortable = "portable"
+)
+
+const (
+	// MaxFileNameBytes is the max length of a sanitized file name, it leaves room within the
+	// 255 bytes limit for the temporary suffixes like ".part.json" and a longer extension.
+	MaxFileNameBytes = 240
+
+	maxExtBytes = 16
+)
+
+type (
+	// Sanitizer makes file names valid on the file systems of its profile.
+	Sanitizer struct {
+		Profile string
+		// FullWidth replaces the invalid characters with their full-width forms instead of deleting them
+		FullWidth bool
+	}
+)
+
+var (
+	defaultSanitizer = &Sanitizer{Profile: DefaultProfile()}
+
+	fullWidthChars = map[rune]rune{
+		'/':  '／',
+		'\\': '＼',
+		':':  '：',
+		'*':  '＊',
+		'?':  '？',
+		'"':  '＂',
+		'<':  '＜',
+		'>':  '＞',
+		'|':  '｜',
+	}
+
+	windowsReservedNames = map[string]bool{
+		"CON": true, "PRN": true, "AUX": true, "NUL": true,
+		"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+		"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+		"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+		"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+	}
+)
+
+// DefaultProfile returns the profile of the build OS.
+func DefaultProfile() string {
+	switch runtime.GOOS {
+	case "windows":
+		return ProfileWindows
+	case "darwin":
+		return ProfileMacOS
+	default:
+		return ProfilePosix
+	}
+}
+
+// NewSanitizer returns a sanitizer of the profile, the profile of the build OS if it's empty.
+func NewSanitizer(profile string, fullWidth bool) (*Sanitizer, error) {
+	switch profile {
+	case "":
+		profile = DefaultProfile()
+	case ProfilePosix, ProfileMacOS, ProfileWindows, ProfilePortable:
+	default:
+		return nil, fmt.Errorf("unknown sanitize profile: %q", profile)
+	}
+	return &Sanitizer{Profile: profile, FullWidth: fullWidth}, nil
+}
+
+// SetSanitizer replaces the sanitizer used by TrimInvalidFilePathChars.
+func SetSanitizer(s *Sanitizer) {
+	defaultSanitizer = s
+}
+
+// Sanitize returns name as a valid file name, composed in NFC and truncated to MaxFileNameBytes
+// with the extension kept. It returns an empty string if nothing valid remains.
+func (s *Sanitizer) Sanitize(name string) string {
+	strict := s.Profile == ProfileWindows || s.Profile == ProfilePortable
+	var sb strings.Builder
+	for _, r := range norm.NFC.String(strings.TrimSpace(name)) {
+		switch {
+		case r < 0x20 || r == 0x7F:
+			continue
+		// Finder shows ':' as '/', and the Carbon APIs take it as the path separator
+		case r == '/' || (r == ':' && s.Profile == ProfileMacOS) ||
+			(strict && strings.ContainsRune(`\:*?"<>|`, r)):
+			if s.FullWidth {
+				sb.WriteRune(fullWidthChars[r])
+			}
+			continue
+		}
+		sb.WriteRune(r)
+	}
+
+	name = truncate(strings.TrimSpace(sb.String()), MaxFileNameBytes)
+	if strict {
+		// Windows drops the trailing dots and spaces, and reserves the device names even with an extension
+		name = strings.TrimRight(name, ". ")
+		stem := name
+		if i := strings.IndexByte(name, '.'); i >= 0 {
+			stem = name[:i]
+		}
+		if windowsReservedNames[strings.ToUpper(strings.TrimRight(stem, " "))] {
+			name = stem + "_" + name[len(stem):]
+		}
+	}
+	if name == "." || name == ".." {
+		return ""
+	}
+	return name
+}
+
+// truncate cuts name to max bytes at a character boundary, the extension is kept
+// if it looks like one.
+func truncate(name string, max int) string {
+	if len(name) <= max {
+		return name
+	}
+
+	ext := ""
+	if i := strings.LastIndexByte(name, '.'); i > 0 && len(name)-i <= maxExtBytes &&
+		!strings.ContainsRune(name[i:], ' ') {
+		ext = name[i:]
+	}
+	n := max - len(ext)
+	for n > 0 && !utf8.RuneStart(name[n]) {
+		n--
+	}
+	return strings.TrimRight(name[:n], " ") + ext
+}
@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSanitizer_Sanitize(t *testing.T) {
+	posix := &Sanitizer{Profile: ProfilePosix}
+	macOS := &Sanitizer{Profile: ProfileMacOS}
+	windows := &Sanitizer{Profile: ProfileWindows}
+	portable := &Sanitizer{Profile: ProfilePortable}
+	fullWidth := &Sanitizer{Profile: ProfilePortable, FullWidth: true}
+
+	tests := []struct {
+		s    *Sanitizer
+		name string
+		want string
+	}{
+		{posix, " AC/DC - What?: *.mp3 ", "ACDC - What?: *.mp3"},
+		{macOS, "AC/DC - What?: *.mp3", "ACDC - What? *.mp3"},
+		{&Sanitizer{Profile: ProfileMacOS, FullWidth: true}, "AC/DC: *.mp3", "AC／DC： *.mp3"},
+		{windows, "AC/DC - What?: *.mp3", "ACDC - What .mp3"},
+		{portable, "a\\b<c>d|e\"f\tg", "abcdefg"},
+		{fullWidth, "AC/DC - What?: *.mp3", "AC／DC - What？： ＊.mp3"},
+		{posix, "Vol. 1...", "Vol. 1..."},
+		{windows, "Vol. 1... ", "Vol. 1"},
+		{windows, "con.mp3", "con_.mp3"},
+		{portable, "LPT1", "LPT1_"},
+		{portable, "CONCERT.mp3", "CONCERT.mp3"},
+		{posix, "CON.mp3", "CON.mp3"},
+		{posix, "..", ""},
+		{windows, "...", ""},
+		{posix, "Beyonce\u0301 - \u1112\u1161\u11ab\u1100\u116e\u11a8", "Beyonc\u00e9 - \ud55c\uad6d"},
+		{posix, "\u1112\u1161\u11ab", "\ud55c"},
+		{posix, "a\u0323\u0302", "\u1ead"},
+		// combining marks are reordered canonically before composed
+		{posix, "a\u0302\u0323", "\u1ead"},
+		// singletons are mapped
+		{posix, "\u212b", "\u00c5"},
+	}
+	for _, test := range tests {
+		if got := test.s.Sanitize(test.name); got != test.want {
+			t.Errorf("Sanitize(%s, %q) = %q, want %q", test.s.Profile, test.name, got, test.want)
+		}
+	}
+}
+
+func TestSanitizer_Truncate(t *testing.T) {
+	s := &Sanitizer{Profile: ProfilePortable}
+
+	name := s.Sanitize(strings.Repeat("晴天", 100) + ".flac")
+	if n := len(name); n > MaxFileNameBytes || n < MaxFileNameBytes-3 || !utf8.ValidString(name) ||
+		!strings.HasSuffix(name, "天.flac") {
+		t.Errorf("Sanitize truncated to %q (%d bytes)", name, len(name))
+	}
+
+	name = s.Sanitize(strings.Repeat("a", 300) + ". b c")
+	if len(name) != MaxFileNameBytes || strings.ContainsRune(name, '.') {
+		t.Errorf("Sanitize truncated to %q (%d bytes)", name, len(name))
+	}
+}
+
+func TestNewSanitizer(t *testing.T) {
+	s, err := NewSanitizer("", false)
+	if err != nil || s.Profile != DefaultProfile() {
+		t.Errorf("NewSanitizer with empty profile = %v, %v", s, err)
+	}
+	if want := map[string]string{"windows": ProfileWindows, "darwin": ProfileMacOS}[runtime.GOOS]; want != "" && s.Profile != want {
+		t.Errorf("NewSanitizer with empty profile on %s = %s, want %s", runtime.GOOS, s.Profile, want)
+	}
+	if _, err = NewSanitizer("dos", false); err == nil {
+		t.Error("NewSanitizer with unknown profile should fail")
+	}
+}